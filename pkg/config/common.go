@@ -16,7 +16,11 @@ package config
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
+	"sync"
+	"time"
+
 	jwterrors "github.com/greenpau/caddy-auth-jwt/pkg/errors"
 )
 
@@ -44,9 +48,28 @@ const EnvTokenECDSAFile = "JWT_ECDSA_FILE"
 // EnvTokenECDSAKey the env variable (or prefix) used to indicate ECDSA key.
 const EnvTokenECDSAKey = "JWT_ECDSA_KEY"
 
+// EnvTokenEdDSADir the env variable used to indicate a directory containing Ed25519 keys.
+const EnvTokenEdDSADir = "JWT_EDDSA_DIR"
+
+// EnvTokenEdDSAFile then env variable used to indicate a file containing an Ed25519 key.
+const EnvTokenEdDSAFile = "JWT_EDDSA_FILE"
+
+// EnvTokenEdDSAKey the env variable used to indicate an Ed25519 key.
+const EnvTokenEdDSAKey = "JWT_EDDSA_KEY"
+
 // EnvTokenSecret the env variable used to indicate shared secret key.
 const EnvTokenSecret = "JWT_TOKEN_SECRET"
 
+// EnvTokenJWKSFile the env variable used to indicate a JWK or JWK Set file.
+const EnvTokenJWKSFile = "JWT_JWKS_FILE"
+
+// EnvTokenJWKSURL the env variable used to indicate a remote JWKS URL.
+const EnvTokenJWKSURL = "JWT_JWKS_URL"
+
+// EnvTokenJWKSVerifyOnly the env variable used to reject private key
+// material found in the configured JWK/JWK Set source.
+const EnvTokenJWKSVerifyOnly = "JWT_JWKS_VERIFY_ONLY"
+
 // EnvTokenLifetime the env variable used to set default token lifetime.
 const EnvTokenLifetime = "JWT_TOKEN_LIFETIME"
 
@@ -63,16 +86,74 @@ type CommonTokenConfig struct {
 	TokenLifetime int      `json:"token_lifetime,omitempty" xml:"token_lifetime" yaml:"token_lifetime"`
 	EvalExpr      []string `json:"token_eval_expr,omitempty" xml:"token_eval_expr" yaml:"token_eval_expr"`
 
+	// TokenJWKSURL is the URL of a remote JWKS document the validator trusts
+	// in addition to, or instead of, locally configured keys.
+	TokenJWKSURL string `json:"token_jwks_url,omitempty" xml:"token_jwks_url" yaml:"token_jwks_url"`
+	// TokenJWKSRefreshInterval, in seconds, when positive, is how long a
+	// fetched JWKS document is trusted before being refetched, in place of
+	// the lifetime its Cache-Control/Expires headers would give.
+	TokenJWKSRefreshInterval int `json:"token_jwks_refresh_interval,omitempty" xml:"token_jwks_refresh_interval" yaml:"token_jwks_refresh_interval"`
+	// TokenJWKSFile points at a JWK (single key) or JWK Set (multiple keys)
+	// file, as served by most OIDC providers, to load key material from.
+	TokenJWKSFile string `json:"token_jwks_file,omitempty" xml:"token_jwks_file" yaml:"token_jwks_file"`
+	// TokenJWKSInline holds a JWK or JWK Set document verbatim, for the cases
+	// where it is more convenient to inline it in the config than to point
+	// at a file.
+	TokenJWKSInline string `json:"token_jwks_inline,omitempty" xml:"token_jwks_inline" yaml:"token_jwks_inline"`
+	// TokenJWKSVerifyOnly rejects any private key material found in
+	// TokenJWKSFile/TokenJWKSInline, so a verifier-only process loading a
+	// JWK Set it does not fully trust can't accidentally pick up and expose
+	// a signing key meant only for the issuer.
+	TokenJWKSVerifyOnly bool `json:"token_jwks_verify_only,omitempty" xml:"token_jwks_verify_only" yaml:"token_jwks_verify_only"`
+	// TokenKeyRefreshInterval, in seconds, is how often a KeyRotator rescans
+	// TokenRSADir/TokenECDSADir/TokenEdDSADir and JWKS sources for new or
+	// removed keys. Zero disables background rotation.
+	TokenKeyRefreshInterval int `json:"token_key_refresh_interval,omitempty" xml:"token_key_refresh_interval" yaml:"token_key_refresh_interval"`
+	// TokenKeyOverlapWindow, in seconds, is how long a key removed from the
+	// underlying source remains valid for verification after rotation, so
+	// tokens signed just before the swap still verify.
+	TokenKeyOverlapWindow int `json:"token_key_overlap_window,omitempty" xml:"token_key_overlap_window" yaml:"token_key_overlap_window"`
+	// TokenSignerURI, when set, delegates signing to a KMS/HSM backend
+	// instead of a locally held private key, e.g.
+	// "awskms://alias/jwt-signer?region=us-east-1". See Signer.
+	TokenSignerURI string `json:"token_signer_uri,omitempty" xml:"token_signer_uri" yaml:"token_signer_uri"`
+	// TokenEncryption, when Alg/Enc are set, wraps issued tokens in a nested
+	// JWE so claims stay opaque to anything that isn't holding the
+	// decryption key.
+	TokenEncryption TokenEncryptionConfig `json:"token_encryption,omitempty" xml:"token_encryption" yaml:"token_encryption"`
+
 	HMACSignMethodConfig
 	RSASignMethodConfig
 	ECDSASignMethodConfig
+	Ed25519SignMethodConfig
 
 	// The source of token configuration, config or environment variables.
 	tokenOrigin string
 	tokenType   string
+	// keysMu guards tokenKeys, keyCreatedAt, and keyExpiresAt so a background
+	// KeyRotator can swap them in while the token provider/validator is
+	// concurrently signing and verifying.
+	keysMu sync.RWMutex
 	// The map containing key material, e.g. *rsa.PrivateKey, *rsa.PublicKey,
 	// *ecdsa.PrivateKey, etc.
 	tokenKeys map[string]interface{}
+	// keyCreatedAt records each kid's creation time (its key file's mtime
+	// where known, otherwise when it was added), so signing can always pick
+	// the newest private key.
+	keyCreatedAt map[string]time.Time
+	// keyExpiresAt holds the time at which a retired kid's overlap window
+	// closes. A kid absent from this map never expires.
+	keyExpiresAt map[string]time.Time
+	// remoteKeysMu guards the lazy initialization of remoteKeys below; the
+	// remoteKeySet it points at has its own internal locking for the cache
+	// it maintains.
+	remoteKeysMu sync.Mutex
+	// remoteKeys caches public keys fetched from TokenJWKSURL, keyed by kid.
+	remoteKeys *remoteKeySet
+	// encryptionKeys holds JWE key material, keyed by kid, separately from
+	// tokenKeys since a single config may sign with one key type and
+	// encrypt with another.
+	encryptionKeys map[string]interface{}
 }
 
 // HMACSignMethodConfig holds configuration for signing messages by means of a shared key.
@@ -163,6 +244,43 @@ type ECDSASignMethodConfig struct {
 	TokenECDSAKey   string            `json:"token_ecdsa_key,omitempty" xml:"token_ecdsa_key" yaml:"token_ecdsa_key"`
 }
 
+// HasEdDSAKeys returns true if the configuration has Ed25519 encryption keys and files
+func (c *CommonTokenConfig) HasEdDSAKeys() bool {
+	if c.TokenEdDSADir != "" {
+		return true
+	}
+	if c.TokenEdDSAFile != "" {
+		return true
+	}
+	if c.TokenEdDSAKey != "" {
+		return true
+	}
+	if c.TokenEdDSAFiles != nil {
+		return true
+	}
+	if c.TokenEdDSAKeys != nil {
+		return true
+	}
+	return false
+}
+
+// HasJWKSURL returns true if the configuration trusts a remote JWKS document.
+func (c *CommonTokenConfig) HasJWKSURL() bool {
+	return c.TokenJWKSURL != ""
+}
+
+// HasSignerURI returns true if the configuration delegates signing to an
+// external Signer backend rather than a locally held private key.
+func (c *CommonTokenConfig) HasSignerURI() bool {
+	return c.TokenSignerURI != ""
+}
+
+// HasJWKSFile returns true if the configuration loads key material from a
+// local JWK or JWK Set document, whether on disk or inlined.
+func (c *CommonTokenConfig) HasJWKSFile() bool {
+	return c.TokenJWKSFile != "" || c.TokenJWKSInline != ""
+}
+
 // HasRSAKeys returns true if the configuration has RSA encryption keys and files
 func (c *CommonTokenConfig) HasRSAKeys() bool {
 	if c.TokenRSADir != "" {
@@ -231,6 +349,8 @@ func (c *CommonTokenConfig) SetOrigin(name string) error {
 
 // GetKeys returns a map with keys.
 func (c *CommonTokenConfig) GetKeys() (string, map[string]interface{}) {
+	c.keysMu.RLock()
+	defer c.keysMu.RUnlock()
 	return c.tokenType, c.tokenKeys
 }
 
@@ -240,6 +360,9 @@ func (c *CommonTokenConfig) AddPublicKey(keyID string, keyMaterial interface{})
 		return jwterrors.ErrKeyIDNotFound
 	}
 
+	c.keysMu.Lock()
+	defer c.keysMu.Unlock()
+
 	if c.tokenKeys == nil {
 		c.tokenKeys = make(map[string]interface{})
 	}
@@ -257,7 +380,14 @@ func (c *CommonTokenConfig) AddPublicKey(keyID string, keyMaterial interface{})
 		if _, exists := c.tokenKeys[defaultKeyID]; !exists {
 			c.tokenKeys[defaultKeyID] = &privkey.PublicKey
 		}
-	case *rsa.PublicKey, *ecdsa.PublicKey:
+	case ed25519.PrivateKey:
+		privkey := keyMaterial.(ed25519.PrivateKey)
+		pubkey := privkey.Public().(ed25519.PublicKey)
+		c.tokenKeys[keyID] = pubkey
+		if _, exists := c.tokenKeys[defaultKeyID]; !exists {
+			c.tokenKeys[defaultKeyID] = pubkey
+		}
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
 		c.tokenKeys[keyID] = keyMaterial
 	default:
 		return jwterrors.ErrUnsupportedKeyType.WithArgs(kt, keyID)
@@ -265,31 +395,59 @@ func (c *CommonTokenConfig) AddPublicKey(keyID string, keyMaterial interface{})
 	return nil
 }
 
-// GetPrivateKey returns the first RSA private key it finds.
+// GetPrivateKey returns the newest private key it finds, so that after a
+// rotation signing moves over to the latest generation while older
+// generations remain around only for verification.
 func (c *CommonTokenConfig) GetPrivateKey() (interface{}, string, error) {
+	c.keysMu.RLock()
+	defer c.keysMu.RUnlock()
 	if c.tokenKeys == nil {
 		return nil, "", jwterrors.ErrRSAKeysNotFound
 	}
+	var newestID string
+	var newestKey interface{}
+	var newestAt time.Time
 	for keyID, k := range c.tokenKeys {
 		if keyID == defaultKeyID {
 			continue
 		}
 		switch k.(type) {
-		case *rsa.PrivateKey:
-			return k, keyID, nil
-		case *ecdsa.PrivateKey:
-			return k, keyID, nil
+		case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+		default:
+			continue
+		}
+		createdAt := c.keyCreatedAt[keyID]
+		if newestKey == nil || createdAt.After(newestAt) {
+			newestID, newestKey, newestAt = keyID, k, createdAt
 		}
 	}
-	switch c.tokenType {
-	case "ecdsa":
-		return nil, "", jwterrors.ErrECDSAKeysNotFound
+	if newestKey == nil {
+		switch c.tokenType {
+		case "ecdsa":
+			return nil, "", jwterrors.ErrECDSAKeysNotFound
+		case "ed25519":
+			return nil, "", jwterrors.ErrEdDSAKeysNotFound
+		}
+		return nil, "", jwterrors.ErrRSAKeysNotFound
 	}
-	return nil, "", jwterrors.ErrRSAKeysNotFound
+	return newestKey, newestID, nil
 }
 
-// AddKey adds token key.
+// AddKey adds token key, stamping it with the current time as its
+// keyCreatedAt. Callers that know a more accurate age for the key, e.g. a
+// key file's mtime, should use AddKeyWithCreatedAt instead so GetPrivateKey
+// picks the newest generation by actual key age rather than process load
+// order.
 func (c *CommonTokenConfig) AddKey(k string, pk interface{}) error {
+	return c.AddKeyWithCreatedAt(k, pk, time.Now())
+}
+
+// AddKeyWithCreatedAt adds token key k with an explicit createdAt, used by
+// LoadKeys to record a key file's mtime instead of the moment this process
+// happened to read it. KeyRotator.rescan records the mtime itself.
+func (c *CommonTokenConfig) AddKeyWithCreatedAt(k string, pk interface{}, createdAt time.Time) error {
+	c.keysMu.Lock()
+	defer c.keysMu.Unlock()
 	if c.tokenKeys == nil {
 		c.tokenKeys = make(map[string]interface{})
 	}
@@ -303,7 +461,19 @@ func (c *CommonTokenConfig) AddKey(k string, pk interface{}) error {
 	if c.tokenType != keyType {
 		return jwterrors.ErrMixedConfigKeyType.WithArgs(c.tokenType, keyType)
 	}
+	if keyType == "ecdsa" && c.TokenSignMethod != "" {
+		wantCurve, err := GetSignMethodCurve(c.TokenSignMethod)
+		if err == nil {
+			if curveErr := validateECDSAKeyCurve(pk, wantCurve); curveErr != nil {
+				return curveErr
+			}
+		}
+	}
 	c.tokenKeys[k] = pk
+	if c.keyCreatedAt == nil {
+		c.keyCreatedAt = make(map[string]time.Time)
+	}
+	c.keyCreatedAt[k] = createdAt
 	return nil
 }
 
@@ -320,6 +490,10 @@ func (c *CommonTokenConfig) getKeyType(k interface{}) (string, error) {
 		kt = "ecdsa"
 	case *ecdsa.PublicKey:
 		kt = "ecdsa"
+	case ed25519.PrivateKey:
+		kt = "ed25519"
+	case ed25519.PublicKey:
+		kt = "ed25519"
 	default:
 		return "", jwterrors.ErrUnsupportedConfigKeyType.WithArgs(k)
 	}
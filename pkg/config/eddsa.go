@@ -0,0 +1,24 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// Ed25519SignMethodConfig defines configuration unique to Ed25519 (EdDSA) keys.
+type Ed25519SignMethodConfig struct {
+	TokenEdDSADir   string            `json:"token_eddsa_dir,omitempty" xml:"token_eddsa_dir" yaml:"token_eddsa_dir"`
+	TokenEdDSAFiles map[string]string `json:"token_eddsa_files,omitempty" xml:"token_eddsa_files" yaml:"token_eddsa_files"`
+	TokenEdDSAKeys  map[string]string `json:"token_eddsa_keys,omitempty" xml:"token_eddsa_keys" yaml:"token_eddsa_keys"`
+	TokenEdDSAFile  string            `json:"token_eddsa_file,omitempty" xml:"token_eddsa_file" yaml:"token_eddsa_file"`
+	TokenEdDSAKey   string            `json:"token_eddsa_key,omitempty" xml:"token_eddsa_key" yaml:"token_eddsa_key"`
+}
@@ -0,0 +1,216 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+
+	jwterrors "github.com/greenpau/caddy-auth-jwt/pkg/errors"
+)
+
+// Supported TokenEncryption.Alg (JWE "alg", i.e. how the CEK is protected)
+// and TokenEncryption.Enc (JWE "enc", i.e. how the payload is protected)
+// values, per RFC 7518 Section 4-5.
+const (
+	KeyAlgRSAOAEP256   = "RSA-OAEP-256"
+	KeyAlgECDHESA256KW = "ECDH-ES+A256KW"
+	KeyAlgDir          = "dir"
+
+	ContentEncA256GCM      = "A256GCM"
+	ContentEncA128CBCHS256 = "A128CBC-HS256"
+)
+
+// TokenEncryptionConfig configures the JWE layer caddy-auth-jwt wraps around
+// a signed token (sign-then-encrypt) when the operator wants claims such as
+// email or group membership opaque to intermediaries. Encryption keys are
+// configured the same way signing keys are: a directory, a map of <kid> to
+// file path, or a map of <kid> to inline key material.
+type TokenEncryptionConfig struct {
+	// Alg is the JWE key management algorithm, e.g. "RSA-OAEP-256",
+	// "ECDH-ES+A256KW", or "dir" (the configured key is used as the CEK
+	// directly, without per-message key wrapping).
+	Alg string `json:"alg,omitempty" xml:"alg" yaml:"alg"`
+	// Enc is the JWE content encryption algorithm, e.g. "A256GCM" or
+	// "A128CBC-HS256".
+	Enc string `json:"enc,omitempty" xml:"enc" yaml:"enc"`
+
+	TokenEncryptionKeyDir   string            `json:"token_encryption_key_dir,omitempty" xml:"token_encryption_key_dir" yaml:"token_encryption_key_dir"`
+	TokenEncryptionKeyFiles map[string]string `json:"token_encryption_key_files,omitempty" xml:"token_encryption_key_files" yaml:"token_encryption_key_files"`
+	TokenEncryptionKeys     map[string]string `json:"token_encryption_keys,omitempty" xml:"token_encryption_keys" yaml:"token_encryption_keys"`
+	TokenEncryptionKeyFile  string            `json:"token_encryption_key_file,omitempty" xml:"token_encryption_key_file" yaml:"token_encryption_key_file"`
+	TokenEncryptionKey      string            `json:"token_encryption_key,omitempty" xml:"token_encryption_key" yaml:"token_encryption_key"`
+}
+
+var validKeyAlgs = map[string]bool{
+	KeyAlgRSAOAEP256:   true,
+	KeyAlgECDHESA256KW: true,
+	KeyAlgDir:          true,
+}
+
+var validContentEncs = map[string]bool{
+	ContentEncA256GCM:      true,
+	ContentEncA128CBCHS256: true,
+}
+
+// Validate checks that Alg and Enc, if set, name algorithms this package
+// implements.
+func (e *TokenEncryptionConfig) Validate() error {
+	if e.Alg != "" && !validKeyAlgs[e.Alg] {
+		return jwterrors.ErrUnsupportedEncryptionAlg.WithArgs(e.Alg)
+	}
+	if e.Enc != "" && !validContentEncs[e.Enc] {
+		return jwterrors.ErrUnsupportedContentEnc.WithArgs(e.Enc)
+	}
+	return nil
+}
+
+// HasEncryptionKeys returns true if the configuration has JWE encryption
+// keys and files, mirroring HasRSAKeys/HasECDSAKeys.
+func (c *CommonTokenConfig) HasEncryptionKeys() bool {
+	if c.TokenEncryption.TokenEncryptionKeyDir != "" {
+		return true
+	}
+	if c.TokenEncryption.TokenEncryptionKeyFile != "" {
+		return true
+	}
+	if c.TokenEncryption.TokenEncryptionKey != "" {
+		return true
+	}
+	if c.TokenEncryption.TokenEncryptionKeyFiles != nil {
+		return true
+	}
+	if c.TokenEncryption.TokenEncryptionKeys != nil {
+		return true
+	}
+	return false
+}
+
+// AddEncryptionKey adds JWE key material under kid, e.g. an *rsa.PublicKey
+// (to encrypt) or *rsa.PrivateKey (to decrypt) for "RSA-OAEP-256", the
+// *ecdsa equivalents for "ECDH-ES+A256KW", or a raw symmetric key for "dir".
+func (c *CommonTokenConfig) AddEncryptionKey(kid string, key interface{}) error {
+	if kid == "" {
+		return jwterrors.ErrKeyIDNotFound
+	}
+	c.keysMu.Lock()
+	defer c.keysMu.Unlock()
+	if c.encryptionKeys == nil {
+		c.encryptionKeys = make(map[string]interface{})
+	}
+	c.encryptionKeys[kid] = key
+	return nil
+}
+
+// GetEncryptionKey returns the JWE key material registered under kid.
+func (c *CommonTokenConfig) GetEncryptionKey(kid string) (interface{}, error) {
+	c.keysMu.RLock()
+	key, exists := c.encryptionKeys[kid]
+	c.keysMu.RUnlock()
+	if !exists {
+		return nil, jwterrors.ErrEncryptionKeyNotFound.WithArgs(kid)
+	}
+	return key, nil
+}
+
+// loadEncryptionKeySources populates encryptionKeys from
+// TokenEncryptionKeyDir/Files/Keys/File/Key, mirroring the signing-key
+// loaders in load.go. The single File/Key fields map to the default kid and
+// are evaluated first, so an explicit "0" entry in the Files/Keys maps below
+// can still override them, same as loadSingleKey/loadKeyMaps. For "dir", the
+// key material is used as-is (the raw symmetric CEK); for RSA-OAEP-256 and
+// ECDH-ES+A256KW it is parsed as a PEM-encoded key, same as a signing key.
+func (c *CommonTokenConfig) loadEncryptionKeySources() error {
+	e := &c.TokenEncryption
+
+	parseKey := func(data []byte) (interface{}, error) {
+		if e.Alg == KeyAlgDir {
+			return data, nil
+		}
+		return parseAnyPrivateOrPublicKey(data)
+	}
+
+	switch {
+	case e.TokenEncryptionKeyFile != "":
+		data, _, err := readFileWithModTime(e.TokenEncryptionKeyFile)
+		if err != nil {
+			return err
+		}
+		key, err := parseKey(data)
+		if err != nil {
+			return err
+		}
+		if err := c.AddEncryptionKey(defaultKeyID, key); err != nil {
+			return err
+		}
+	case e.TokenEncryptionKey != "":
+		key, err := parseKey([]byte(e.TokenEncryptionKey))
+		if err != nil {
+			return err
+		}
+		if err := c.AddEncryptionKey(defaultKeyID, key); err != nil {
+			return err
+		}
+	}
+
+	for kid, path := range e.TokenEncryptionKeyFiles {
+		data, _, err := readFileWithModTime(path)
+		if err != nil {
+			return err
+		}
+		key, err := parseKey(data)
+		if err != nil {
+			return err
+		}
+		if err := c.AddEncryptionKey(kid, key); err != nil {
+			return err
+		}
+	}
+	for kid, material := range e.TokenEncryptionKeys {
+		key, err := parseKey([]byte(material))
+		if err != nil {
+			return err
+		}
+		if err := c.AddEncryptionKey(kid, key); err != nil {
+			return err
+		}
+	}
+
+	if e.TokenEncryptionKeyDir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(e.TokenEncryptionKeyDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(e.TokenEncryptionKeyDir, entry.Name())
+		data, _, err := readFileWithModTime(path)
+		if err != nil {
+			return err
+		}
+		key, err := parseKey(data)
+		if err != nil {
+			return err
+		}
+		if err := c.AddEncryptionKey(strippedKeyFileName(entry.Name()), key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,341 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+
+	jwterrors "github.com/greenpau/caddy-auth-jwt/pkg/errors"
+)
+
+type jweHeader struct {
+	Alg string  `json:"alg"`
+	Enc string  `json:"enc"`
+	Kid string  `json:"kid,omitempty"`
+	Epk *epkJWK `json:"epk,omitempty"`
+}
+
+// epkJWK is the ephemeral EC public key ECDH-ES(+A256KW) carries in the
+// protected header, per RFC 7518 Section 4.6.
+type epkJWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Encrypt wraps payload (normally a signed JWS, for sign-then-encrypt nested
+// tokens) in a compact-serialized JWE using kid's encryption key and the
+// configured Alg/Enc.
+func (c *CommonTokenConfig) Encrypt(kid string, payload []byte) (string, error) {
+	if err := c.TokenEncryption.Validate(); err != nil {
+		return "", err
+	}
+	key, err := c.GetEncryptionKey(kid)
+	if err != nil {
+		return "", err
+	}
+
+	alg, enc := c.TokenEncryption.Alg, c.TokenEncryption.Enc
+	cek, encryptedKey, epk, err := wrapCEK(alg, enc, key)
+	if err != nil {
+		return "", err
+	}
+
+	header := jweHeader{Alg: alg, Enc: enc, Kid: kid, Epk: epk}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	aad := base64.RawURLEncoding.EncodeToString(headerJSON)
+
+	iv, ciphertext, tag, err := contentEncrypt(header.Enc, cek, payload, []byte(aad))
+	if err != nil {
+		return "", err
+	}
+
+	return aad + "." +
+		base64.RawURLEncoding.EncodeToString(encryptedKey) + "." +
+		base64.RawURLEncoding.EncodeToString(iv) + "." +
+		base64.RawURLEncoding.EncodeToString(ciphertext) + "." +
+		base64.RawURLEncoding.EncodeToString(tag), nil
+}
+
+// Decrypt reverses Encrypt, returning the plaintext payload (normally the
+// nested JWS to hand to the token validator).
+func (c *CommonTokenConfig) Decrypt(token string) ([]byte, error) {
+	parts, err := splitJWE(token)
+	if err != nil {
+		return nil, err
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, jwterrors.ErrInvalidJWE.WithArgs(err)
+	}
+	var header jweHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, jwterrors.ErrInvalidJWE.WithArgs(err)
+	}
+
+	key, err := c.GetEncryptionKey(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedKey, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, jwterrors.ErrInvalidJWE.WithArgs(err)
+	}
+	iv, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, jwterrors.ErrInvalidJWE.WithArgs(err)
+	}
+	ciphertext, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, jwterrors.ErrInvalidJWE.WithArgs(err)
+	}
+	tag, err := base64.RawURLEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, jwterrors.ErrInvalidJWE.WithArgs(err)
+	}
+
+	cek, err := unwrapCEK(header.Alg, header.Enc, key, encryptedKey, header.Epk)
+	if err != nil {
+		return nil, err
+	}
+
+	return contentDecrypt(header.Enc, cek, iv, ciphertext, tag, []byte(parts[0]))
+}
+
+func splitJWE(token string) ([]string, error) {
+	var parts []string
+	start := 0
+	for i := 0; i < len(token); i++ {
+		if token[i] == '.' {
+			parts = append(parts, token[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, token[start:])
+	if len(parts) != 5 {
+		return nil, jwterrors.ErrInvalidJWE.WithArgs("expected 5 compact-serialization segments")
+	}
+	return parts, nil
+}
+
+// wrapCEK produces a fresh content-encryption key of the size enc requires,
+// protected according to alg. For ECDH-ES+A256KW it also returns the
+// ephemeral public key the caller must publish in the JWE header's "epk"
+// member so the recipient can repeat the key agreement.
+func wrapCEK(alg, enc string, key interface{}) (cek, encryptedKey []byte, epk *epkJWK, err error) {
+	switch alg {
+	case KeyAlgRSAOAEP256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, nil, nil, jwterrors.ErrUnsupportedKeyType.WithArgs(key, "jwe")
+		}
+		cek = make([]byte, cekSize(enc))
+		if _, err := rand.Read(cek); err != nil {
+			return nil, nil, nil, err
+		}
+		encryptedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, cek, nil)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return cek, encryptedKey, nil, nil
+	case KeyAlgECDHESA256KW:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, nil, nil, jwterrors.ErrUnsupportedKeyType.WithArgs(key, "jwe")
+		}
+		cek = make([]byte, cekSize(enc))
+		if _, err := rand.Read(cek); err != nil {
+			return nil, nil, nil, err
+		}
+		encryptedKey, epk, err = ecdhESA256KWWrap(pub, cek)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return cek, encryptedKey, epk, nil
+	case KeyAlgDir:
+		cek, ok := key.([]byte)
+		if !ok {
+			return nil, nil, nil, jwterrors.ErrUnsupportedKeyType.WithArgs(key, "jwe")
+		}
+		return cek, []byte{}, nil, nil
+	default:
+		return nil, nil, nil, jwterrors.ErrUnsupportedEncryptionAlg.WithArgs(alg)
+	}
+}
+
+func unwrapCEK(alg, enc string, key interface{}, encryptedKey []byte, epk *epkJWK) ([]byte, error) {
+	switch alg {
+	case KeyAlgRSAOAEP256:
+		priv, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, jwterrors.ErrUnsupportedKeyType.WithArgs(key, "jwe")
+		}
+		return rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, encryptedKey, nil)
+	case KeyAlgECDHESA256KW:
+		priv, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, jwterrors.ErrUnsupportedKeyType.WithArgs(key, "jwe")
+		}
+		return ecdhESA256KWUnwrap(priv, epk, encryptedKey)
+	case KeyAlgDir:
+		cek, ok := key.([]byte)
+		if !ok {
+			return nil, jwterrors.ErrUnsupportedKeyType.WithArgs(key, "jwe")
+		}
+		return cek, nil
+	default:
+		return nil, jwterrors.ErrUnsupportedEncryptionAlg.WithArgs(alg)
+	}
+}
+
+func cekSize(enc string) int {
+	switch enc {
+	case ContentEncA256GCM:
+		return 32
+	case ContentEncA128CBCHS256:
+		return 32 // 16-byte AES key + 16-byte HMAC key
+	default:
+		return 32
+	}
+}
+
+func contentEncrypt(enc string, cek, plaintext, aad []byte) (iv, ciphertext, tag []byte, err error) {
+	switch enc {
+	case ContentEncA256GCM:
+		block, err := aes.NewCipher(cek)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		iv = make([]byte, gcm.NonceSize())
+		if _, err := rand.Read(iv); err != nil {
+			return nil, nil, nil, err
+		}
+		sealed := gcm.Seal(nil, iv, plaintext, aad)
+		ciphertext, tag = sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+		return iv, ciphertext, tag, nil
+	case ContentEncA128CBCHS256:
+		return cbcHS256Encrypt(cek, plaintext, aad)
+	default:
+		return nil, nil, nil, jwterrors.ErrUnsupportedContentEnc.WithArgs(enc)
+	}
+}
+
+func contentDecrypt(enc string, cek, iv, ciphertext, tag, aad []byte) ([]byte, error) {
+	switch enc {
+	case ContentEncA256GCM:
+		block, err := aes.NewCipher(cek)
+		if err != nil {
+			return nil, err
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		sealed := append(append([]byte{}, ciphertext...), tag...)
+		return gcm.Open(nil, iv, sealed, aad)
+	case ContentEncA128CBCHS256:
+		return cbcHS256Decrypt(cek, iv, ciphertext, tag, aad)
+	default:
+		return nil, jwterrors.ErrUnsupportedContentEnc.WithArgs(enc)
+	}
+}
+
+// cbcHS256Encrypt implements A128CBC-HS256 (RFC 7518 Section 5.2.3): the CEK
+// is split into a 16-byte HMAC-SHA256 MAC key and a 16-byte AES-128 key, the
+// plaintext is CBC-encrypted under a random IV, and the tag is the leftmost
+// half of HMAC-SHA256(MAC key, AAD || IV || ciphertext || AAD bit length).
+func cbcHS256Encrypt(cek, plaintext, aad []byte) (iv, ciphertext, tag []byte, err error) {
+	macKey, encKey := cek[:16], cek[16:]
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	iv = make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, nil, nil, err
+	}
+	padded := pkcs7Pad(plaintext, aes.BlockSize)
+	ciphertext = make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+	tag = cbcHS256Tag(macKey, aad, iv, ciphertext)
+	return iv, ciphertext, tag, nil
+}
+
+func cbcHS256Decrypt(cek, iv, ciphertext, tag, aad []byte) ([]byte, error) {
+	macKey, encKey := cek[:16], cek[16:]
+	if !hmac.Equal(tag, cbcHS256Tag(macKey, aad, iv, ciphertext)) {
+		return nil, jwterrors.ErrInvalidJWE.WithArgs("authentication tag mismatch")
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext)%aes.BlockSize != 0 {
+		return nil, jwterrors.ErrInvalidJWE.WithArgs("ciphertext is not a multiple of the block size")
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+	return pkcs7Unpad(plaintext)
+}
+
+func cbcHS256Tag(macKey, aad, iv, ciphertext []byte) []byte {
+	al := make([]byte, 8)
+	binary.BigEndian.PutUint64(al, uint64(len(aad))*8)
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(aad)
+	mac.Write(iv)
+	mac.Write(ciphertext)
+	mac.Write(al)
+	return mac.Sum(nil)[:16]
+}
+
+func pkcs7Pad(data []byte, blockSize int) []byte {
+	padLen := blockSize - len(data)%blockSize
+	padded := make([]byte, len(data)+padLen)
+	copy(padded, data)
+	for i := len(data); i < len(padded); i++ {
+		padded[i] = byte(padLen)
+	}
+	return padded
+}
+
+func pkcs7Unpad(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, jwterrors.ErrInvalidJWE.WithArgs("empty plaintext")
+	}
+	padLen := int(data[len(data)-1])
+	if padLen == 0 || padLen > len(data) {
+		return nil, jwterrors.ErrInvalidJWE.WithArgs("invalid padding")
+	}
+	return data[:len(data)-padLen], nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+)
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirKey := make([]byte, 32)
+	if _, err := rand.Read(dirKey); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		name       string
+		alg        string
+		enc        string
+		encryptKey interface{}
+		decryptKey interface{}
+	}{
+		{name: "RSA-OAEP-256 with A256GCM", alg: KeyAlgRSAOAEP256, enc: ContentEncA256GCM, encryptKey: &rsaKey.PublicKey, decryptKey: rsaKey},
+		{name: "RSA-OAEP-256 with A128CBC-HS256", alg: KeyAlgRSAOAEP256, enc: ContentEncA128CBCHS256, encryptKey: &rsaKey.PublicKey, decryptKey: rsaKey},
+		{name: "ECDH-ES+A256KW with A256GCM", alg: KeyAlgECDHESA256KW, enc: ContentEncA256GCM, encryptKey: &ecdsaKey.PublicKey, decryptKey: ecdsaKey},
+		{name: "ECDH-ES+A256KW with A128CBC-HS256", alg: KeyAlgECDHESA256KW, enc: ContentEncA128CBCHS256, encryptKey: &ecdsaKey.PublicKey, decryptKey: ecdsaKey},
+		{name: "dir with A256GCM", alg: KeyAlgDir, enc: ContentEncA256GCM, encryptKey: dirKey, decryptKey: dirKey},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			enc := &CommonTokenConfig{TokenEncryption: TokenEncryptionConfig{Alg: tc.alg, Enc: tc.enc}}
+			if err := enc.AddEncryptionKey("k1", tc.encryptKey); err != nil {
+				t.Fatal(err)
+			}
+			payload := []byte("the quick brown fox jumps over the lazy dog")
+			token, err := enc.Encrypt("k1", payload)
+			if err != nil {
+				t.Fatalf("Encrypt: %v", err)
+			}
+
+			dec := &CommonTokenConfig{TokenEncryption: TokenEncryptionConfig{Alg: tc.alg, Enc: tc.enc}}
+			if err := dec.AddEncryptionKey("k1", tc.decryptKey); err != nil {
+				t.Fatal(err)
+			}
+			got, err := dec.Decrypt(token)
+			if err != nil {
+				t.Fatalf("Decrypt: %v", err)
+			}
+			if string(got) != string(payload) {
+				t.Fatalf("round trip mismatch: got %q want %q", got, payload)
+			}
+		})
+	}
+}
+
+func TestDecryptRejectsTamperedCiphertext(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	c := &CommonTokenConfig{TokenEncryption: TokenEncryptionConfig{Alg: KeyAlgDir, Enc: ContentEncA256GCM}}
+	if err := c.AddEncryptionKey("k1", key); err != nil {
+		t.Fatal(err)
+	}
+	token, err := c.Encrypt("k1", []byte("sensitive claims"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip a character in the middle of the ciphertext segment (the fourth
+	// of the five) rather than the very last character of the token: the
+	// last base64url character of a non-multiple-of-3 segment can carry
+	// unused padding bits, so replacing it doesn't reliably change the
+	// decoded bytes.
+	segs := strings.Split(token, ".")
+	mid := len(segs[0]) + len(segs[1]) + len(segs[2]) + 3 + len(segs[3])/2
+	flipped := byte('A')
+	if token[mid] == 'A' {
+		flipped = 'B'
+	}
+	tampered := token[:mid] + string(flipped) + token[mid+1:]
+	if _, err := c.Decrypt(tampered); err == nil {
+		t.Fatal("expected tampered JWE to fail authentication")
+	}
+}
+
+func TestAESKeyWrapRFC3394TestVector(t *testing.T) {
+	// RFC 3394 Section 4.1: wrap a 128-bit key with a 128-bit KEK.
+	kek := []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0A, 0x0B, 0x0C, 0x0D, 0x0E, 0x0F}
+	cek := []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}
+	want := []byte{
+		0x1F, 0xA6, 0x8B, 0x0A, 0x81, 0x12, 0xB4, 0x47,
+		0xAE, 0xF3, 0x4B, 0xD8, 0xFB, 0x5A, 0x7B, 0x82,
+		0x9D, 0x3E, 0x86, 0x23, 0x71, 0xD2, 0xCF, 0xE5,
+	}
+
+	got, err := aesKeyWrap(kek, cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Fatalf("aesKeyWrap = %x, want %x", got, want)
+	}
+
+	back, err := aesKeyUnwrap(kek, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(back) != string(cek) {
+		t.Fatalf("aesKeyUnwrap = %x, want %x", back, cek)
+	}
+}
+
+func TestAESKeyUnwrapRejectsTamperedInput(t *testing.T) {
+	kek := make([]byte, 32)
+	if _, err := rand.Read(kek); err != nil {
+		t.Fatal(err)
+	}
+	cek := make([]byte, 32)
+	if _, err := rand.Read(cek); err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := aesKeyWrap(kek, cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped[0] ^= 0xFF
+	if _, err := aesKeyUnwrap(kek, wrapped); err == nil {
+		t.Fatal("expected tampered wrapped key to fail the integrity check")
+	}
+}
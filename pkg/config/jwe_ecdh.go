@@ -0,0 +1,260 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/aes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"math/big"
+
+	jwterrors "github.com/greenpau/caddy-auth-jwt/pkg/errors"
+)
+
+// ecdhESA256KWWrap generates an ephemeral EC key pair on pub's curve,
+// derives a key-encryption key from the ECDH shared secret via the Concat
+// KDF (NIST SP 800-56A) with AlgorithmID "ECDH-ES+A256KW", and AES Key Wraps
+// (RFC 3394) cek under it. It returns the wrapped key and the ephemeral
+// public key to carry in the JWE header's "epk" member, per RFC 7518
+// Section 4.6.
+func ecdhESA256KWWrap(pub *ecdsa.PublicKey, cek []byte) (encryptedKey []byte, epk *epkJWK, err error) {
+	curve, crv, err := ecdhCurve(pub.Curve)
+	if err != nil {
+		return nil, nil, err
+	}
+	recipient, err := pub.ECDH()
+	if err != nil {
+		return nil, nil, jwterrors.ErrInvalidKey.WithArgs(err)
+	}
+
+	ephemeral, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	secret, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	kek := concatKDF(secret, KeyAlgECDHESA256KW, 32)
+	encryptedKey, err = aesKeyWrap(kek, cek)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	x, y := splitUncompressedECPoint(ephemeral.PublicKey().Bytes())
+	epk = &epkJWK{
+		Kty: "EC",
+		Crv: crv,
+		X:   base64.RawURLEncoding.EncodeToString(x),
+		Y:   base64.RawURLEncoding.EncodeToString(y),
+	}
+	return encryptedKey, epk, nil
+}
+
+// ecdhESA256KWUnwrap reverses ecdhESA256KWWrap: it rebuilds the sender's
+// ephemeral public key from epk, computes the same ECDH shared secret and
+// Concat KDF derived key-encryption key using priv, and AES Key Unwraps
+// encryptedKey to recover the CEK.
+func ecdhESA256KWUnwrap(priv *ecdsa.PrivateKey, epk *epkJWK, encryptedKey []byte) ([]byte, error) {
+	if epk == nil {
+		return nil, jwterrors.ErrInvalidJWE.WithArgs("missing epk header for ECDH-ES+A256KW")
+	}
+	if _, _, err := ecdhCurve(priv.Curve); err != nil {
+		return nil, err
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(epk.X)
+	if err != nil {
+		return nil, jwterrors.ErrInvalidJWE.WithArgs(err)
+	}
+	y, err := base64.RawURLEncoding.DecodeString(epk.Y)
+	if err != nil {
+		return nil, jwterrors.ErrInvalidJWE.WithArgs(err)
+	}
+	ephemeralPub := &ecdsa.PublicKey{Curve: priv.Curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	ephemeral, err := ephemeralPub.ECDH()
+	if err != nil {
+		return nil, jwterrors.ErrInvalidJWE.WithArgs(err)
+	}
+
+	recipient, err := priv.ECDH()
+	if err != nil {
+		return nil, jwterrors.ErrInvalidKey.WithArgs(err)
+	}
+	secret, err := recipient.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	kek := concatKDF(secret, KeyAlgECDHESA256KW, 32)
+	return aesKeyUnwrap(kek, encryptedKey)
+}
+
+// ecdhCurve maps an elliptic.Curve used by an ecdsa key to the matching
+// crypto/ecdh curve and JWK "crv" name. Only the NIST curves this package
+// already pins sign methods to (sign_method.go) are supported.
+func ecdhCurve(curve elliptic.Curve) (ecdh.Curve, string, error) {
+	switch curve {
+	case elliptic.P256():
+		return ecdh.P256(), "P-256", nil
+	case elliptic.P384():
+		return ecdh.P384(), "P-384", nil
+	case elliptic.P521():
+		return ecdh.P521(), "P-521", nil
+	default:
+		return nil, "", jwterrors.ErrUnsupportedKeyType.WithArgs(curve.Params().Name, "ecdh-es")
+	}
+}
+
+// splitUncompressedECPoint splits the uncompressed point encoding
+// (crypto/ecdh's PublicKey.Bytes(), 0x04 || X || Y) into its X and Y
+// coordinates.
+func splitUncompressedECPoint(point []byte) (x, y []byte) {
+	coord := (len(point) - 1) / 2
+	return point[1 : 1+coord], point[1+coord:]
+}
+
+// concatKDF implements the Concat KDF from NIST SP 800-56A as profiled by
+// RFC 7518 Section 4.6 for ECDH-ES(+AxxxKW): a single round of
+// SHA-256(counter || Z || OtherInfo), where OtherInfo is
+// AlgorithmID || PartyUInfo || PartyVInfo || SuppPubInfo, each length-
+// prefixed per the JOSE profile. This package only derives 256-bit keys,
+// so a single hash round always suffices.
+func concatKDF(z []byte, algorithmID string, keyLenBytes int) []byte {
+	algID := lengthPrefixed([]byte(algorithmID))
+	partyUInfo := lengthPrefixed(nil)
+	partyVInfo := lengthPrefixed(nil)
+	suppPubInfo := make([]byte, 4)
+	binary.BigEndian.PutUint32(suppPubInfo, uint32(keyLenBytes)*8)
+
+	counter := []byte{0, 0, 0, 1}
+	h := sha256.New()
+	h.Write(counter)
+	h.Write(z)
+	h.Write(algID)
+	h.Write(partyUInfo)
+	h.Write(partyVInfo)
+	h.Write(suppPubInfo)
+	return h.Sum(nil)[:keyLenBytes]
+}
+
+func lengthPrefixed(data []byte) []byte {
+	out := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(out, uint32(len(data)))
+	copy(out[4:], data)
+	return out
+}
+
+// aesKeyWrapIV is the default 8-byte initial value from RFC 3394 Section
+// 2.2.3.1.
+var aesKeyWrapIV = [8]byte{0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6}
+
+// aesKeyWrap implements the AES Key Wrap algorithm from RFC 3394. plaintext
+// must be a multiple of 8 bytes; cek is always 32 bytes in this package, so
+// that always holds.
+func aesKeyWrap(kek, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(plaintext)%8 != 0 {
+		return nil, jwterrors.ErrInvalidKey.WithArgs("key wrap input is not a multiple of 8 bytes")
+	}
+	n := len(plaintext) / 8
+	r := make([][8]byte, n)
+	for i := 0; i < n; i++ {
+		copy(r[i][:], plaintext[i*8:(i+1)*8])
+	}
+
+	a := aesKeyWrapIV
+	buf := make([]byte, 16)
+	for j := 0; j <= 5; j++ {
+		for i := 1; i <= n; i++ {
+			copy(buf[:8], a[:])
+			copy(buf[8:], r[i-1][:])
+			block.Encrypt(buf, buf)
+			t := uint64(n*j + i)
+			var tBytes [8]byte
+			binary.BigEndian.PutUint64(tBytes[:], t)
+			copy(a[:], buf[:8])
+			for k := range a {
+				a[k] ^= tBytes[k]
+			}
+			copy(r[i-1][:], buf[8:])
+		}
+	}
+
+	out := make([]byte, 0, 8+len(plaintext))
+	out = append(out, a[:]...)
+	for i := 0; i < n; i++ {
+		out = append(out, r[i][:]...)
+	}
+	return out, nil
+}
+
+// aesKeyUnwrap reverses aesKeyWrap and verifies the integrity check value
+// matches the RFC 3394 default IV, rejecting a tampered or mis-keyed
+// wrapped key.
+func aesKeyUnwrap(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 16 || len(wrapped)%8 != 0 {
+		return nil, jwterrors.ErrInvalidJWE.WithArgs("malformed wrapped key")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(wrapped)/8 - 1
+	var a [8]byte
+	copy(a[:], wrapped[:8])
+	r := make([][8]byte, n)
+	for i := 0; i < n; i++ {
+		copy(r[i][:], wrapped[8+i*8:8+(i+1)*8])
+	}
+
+	buf := make([]byte, 16)
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			var tBytes [8]byte
+			binary.BigEndian.PutUint64(tBytes[:], t)
+			var aXorT [8]byte
+			for k := range a {
+				aXorT[k] = a[k] ^ tBytes[k]
+			}
+			copy(buf[:8], aXorT[:])
+			copy(buf[8:], r[i-1][:])
+			block.Decrypt(buf, buf)
+			copy(a[:], buf[:8])
+			copy(r[i-1][:], buf[8:])
+		}
+	}
+
+	if subtle.ConstantTimeCompare(a[:], aesKeyWrapIV[:]) != 1 {
+		return nil, jwterrors.ErrInvalidJWE.WithArgs("key unwrap integrity check failed")
+	}
+
+	out := make([]byte, 0, n*8)
+	for i := 0; i < n; i++ {
+		out = append(out, r[i][:]...)
+	}
+	return out, nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeRSAPublicKeyFile(t *testing.T, dir, name string, pub *rsa.PublicKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestLoadEncryptionKeySourcesLoadsDirKeyFile confirms TokenEncryptionKeyFile
+// is actually read and registered under the default kid when Alg is "dir",
+// where the key material is the raw CEK rather than PEM.
+func TestLoadEncryptionKeySourcesLoadsDirKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cek.bin")
+	want := []byte("0123456789abcdef0123456789abcdef")
+	if err := os.WriteFile(path, want, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &CommonTokenConfig{TokenEncryption: TokenEncryptionConfig{Alg: KeyAlgDir, Enc: ContentEncA256GCM}}
+	c.TokenEncryption.TokenEncryptionKeyFile = path
+	if err := c.loadEncryptionKeySources(); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := c.GetEncryptionKey(defaultKeyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := key.([]byte)
+	if !ok {
+		t.Fatalf("expected []byte key, got %T", key)
+	}
+	if string(got) != string(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+// TestLoadEncryptionKeySourcesLoadsKeyDir confirms TokenEncryptionKeyDir is
+// scanned the same way TokenRSADir is, for RSA-OAEP-256 PEM key material.
+func TestLoadEncryptionKeySourcesLoadsKeyDir(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeRSAPublicKeyFile(t, dir, "enc1.pem", &rsaKey.PublicKey)
+
+	c := &CommonTokenConfig{TokenEncryption: TokenEncryptionConfig{Alg: KeyAlgRSAOAEP256, Enc: ContentEncA256GCM}}
+	c.TokenEncryption.TokenEncryptionKeyDir = dir
+	if err := c.loadEncryptionKeySources(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.GetEncryptionKey("enc1"); err != nil {
+		t.Fatalf("expected key \"enc1\" to be loaded from the directory scan: %v", err)
+	}
+}
+
+// TestLoadEncryptionKeySourcesLoadsKeysMap confirms TokenEncryptionKeys
+// (inline <kid>-to-material map) is honored, and that an explicit kid in the
+// map overrides the single TokenEncryptionKeyFile/TokenEncryptionKey fields,
+// matching loadKeyMaps' precedence for signing keys.
+func TestLoadEncryptionKeySourcesLoadsKeysMap(t *testing.T) {
+	c := &CommonTokenConfig{TokenEncryption: TokenEncryptionConfig{Alg: KeyAlgDir, Enc: ContentEncA256GCM}}
+	c.TokenEncryption.TokenEncryptionKey = "default-cek-0123456789abcdef01"
+	c.TokenEncryption.TokenEncryptionKeys = map[string]string{defaultKeyID: "override-cek-0123456789abcdef0"}
+	if err := c.loadEncryptionKeySources(); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := c.GetEncryptionKey(defaultKeyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(key.([]byte)) != "override-cek-0123456789abcdef0" {
+		t.Fatalf("expected the TokenEncryptionKeys map entry to win, got %q", key)
+	}
+}
+
+// TestLoadEncryptionKeySourcesNoop confirms the loader is a harmless no-op
+// when none of the encryption key fields are set, so it's safe to call
+// unconditionally from load().
+func TestLoadEncryptionKeySourcesNoop(t *testing.T) {
+	c := &CommonTokenConfig{}
+	if err := c.loadEncryptionKeySources(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetEncryptionKey(defaultKeyID); err == nil {
+		t.Fatal("expected no encryption key to be registered")
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	jwterrors "github.com/greenpau/caddy-auth-jwt/pkg/errors"
+	"github.com/greenpau/caddy-auth-jwt/pkg/jwks"
+)
+
+// jwkDoc is the subset of RFC 7517 fields caddy-auth-jwt understands, plus
+// the private-key components needed to load a JWK as a signing key. It
+// carries jwks.Key's key-material fields (but not "use"/"alg") plus the
+// private components, so a single parse handles both public and private
+// material.
+type jwkDoc struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	D   string `json:"d,omitempty"` // RSA/EC/OKP private exponent/scalar
+	P   string `json:"p,omitempty"` // RSA private factor
+	Q   string `json:"q,omitempty"` // RSA private factor
+}
+
+// jwkSetDoc is a JWK Set document, i.e. multiple jwkDoc entries.
+type jwkSetDoc struct {
+	Keys []jwkDoc `json:"keys"`
+}
+
+// isJWKSetFile reports whether name looks like a JWK Set, as opposed to a
+// single JWK, based on its filename. This only drives which error message is
+// produced on a parse failure; both forms are actually auto-detected by
+// shape (presence of a top-level "keys" array).
+func isJWKSetFile(name string) bool {
+	base := filepath.Base(name)
+	return strings.HasSuffix(base, ".jwks.json")
+}
+
+// loadJWKFile parses data as either a single JWK or a JWK Set and returns the
+// key material it contains, keyed by kid. For a single JWK with no "kid"
+// field, name (normally the source filename, minus extension) is used as the
+// fallback kid. When verifyOnly is true, any JWK carrying private key
+// components is rejected, so a verifier-only process can't accidentally load
+// signing material.
+func loadJWKFile(name string, data []byte, verifyOnly bool) (map[string]interface{}, error) {
+	var set jwkSetDoc
+	if err := json.Unmarshal(data, &set); err == nil && len(set.Keys) > 0 {
+		keys := make(map[string]interface{})
+		for i, doc := range set.Keys {
+			kid := doc.Kid
+			if kid == "" {
+				kid = defaultFallbackKid(name, i)
+			}
+			key, err := doc.parse(verifyOnly)
+			if err != nil {
+				return nil, err
+			}
+			keys[kid] = key
+		}
+		return keys, nil
+	}
+
+	var doc jwkDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		if isJWKSetFile(name) {
+			return nil, jwterrors.ErrInvalidJWK.WithArgs(name, "expected a JWK Set document (\"keys\" array): "+err.Error())
+		}
+		return nil, jwterrors.ErrInvalidJWK.WithArgs(name, err)
+	}
+	kid := doc.Kid
+	if kid == "" {
+		kid = defaultFallbackKid(name, 0)
+	}
+	key, err := doc.parse(verifyOnly)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{kid: key}, nil
+}
+
+func defaultFallbackKid(name string, index int) string {
+	base := filepath.Base(name)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	base = strings.TrimSuffix(base, ".jwk")
+	base = strings.TrimSuffix(base, ".jwks")
+	if index == 0 {
+		return base
+	}
+	return base + "_" + itoa(index)
+}
+
+func itoa(i int) string {
+	if i == 0 {
+		return "0"
+	}
+	digits := []byte{}
+	for i > 0 {
+		digits = append([]byte{byte('0' + i%10)}, digits...)
+		i /= 10
+	}
+	return string(digits)
+}
+
+// parse validates kty/crv consistency and decodes d into the concrete key
+// material (public-only unless the private components are present). A JWK
+// carrying "d" is rejected outright when verifyOnly is true.
+func (doc jwkDoc) parse(verifyOnly bool) (interface{}, error) {
+	isPrivate := doc.D != ""
+	if isPrivate && verifyOnly {
+		return nil, jwterrors.ErrJWKPrivateKeyRejected.WithArgs(doc.Kid)
+	}
+
+	switch doc.Kty {
+	case "RSA":
+		if doc.N == "" || doc.E == "" {
+			return nil, jwterrors.ErrInvalidJWK.WithArgs(doc.Kid, "missing n/e")
+		}
+	case "EC":
+		switch doc.Crv {
+		case "P-256", "P-384", "P-521":
+		default:
+			return nil, jwterrors.ErrInvalidJWK.WithArgs(doc.Kid, "unsupported or missing crv for EC key")
+		}
+		if doc.X == "" || doc.Y == "" {
+			return nil, jwterrors.ErrInvalidJWK.WithArgs(doc.Kid, "missing x/y")
+		}
+	case "OKP":
+		if doc.Crv != "Ed25519" {
+			return nil, jwterrors.ErrInvalidJWK.WithArgs(doc.Kid, "unsupported or missing crv for OKP key")
+		}
+		if doc.X == "" {
+			return nil, jwterrors.ErrInvalidJWK.WithArgs(doc.Kid, "missing x")
+		}
+	default:
+		return nil, jwterrors.ErrUnsupportedKeyType.WithArgs(doc.Kty, doc.Kid)
+	}
+
+	if isPrivate {
+		return doc.parsePrivate()
+	}
+
+	return parseJWKPublicKey(jwks.Key{
+		Kty: doc.Kty,
+		Kid: doc.Kid,
+		Crv: doc.Crv,
+		X:   doc.X,
+		Y:   doc.Y,
+		N:   doc.N,
+		E:   doc.E,
+	})
+}
+
+// parsePrivate decodes the private key components of doc. It assumes
+// kty/crv were already validated by parse.
+func (doc jwkDoc) parsePrivate() (interface{}, error) {
+	d, err := b64Decode(doc.D)
+	if err != nil {
+		return nil, jwterrors.ErrInvalidJWK.WithArgs(doc.Kid, err)
+	}
+
+	switch doc.Kty {
+	case "RSA":
+		n, err := b64Decode(doc.N)
+		if err != nil {
+			return nil, jwterrors.ErrInvalidJWK.WithArgs(doc.Kid, err)
+		}
+		e, err := b64Decode(doc.E)
+		if err != nil {
+			return nil, jwterrors.ErrInvalidJWK.WithArgs(doc.Kid, err)
+		}
+		p, errP := b64Decode(doc.P)
+		q, errQ := b64Decode(doc.Q)
+		if errP != nil || errQ != nil {
+			return nil, jwterrors.ErrInvalidJWK.WithArgs(doc.Kid, "missing p/q")
+		}
+		return newRSAPrivateKey(n, e, d, p, q)
+	case "EC":
+		pub, err := parseJWKPublicKey(jwks.Key{Kty: "EC", Crv: doc.Crv, X: doc.X, Y: doc.Y, Kid: doc.Kid})
+		if err != nil {
+			return nil, err
+		}
+		return newECDSAPrivateKey(pub, d), nil
+	case "OKP":
+		return ed25519NewKeyFromSeed(d), nil
+	default:
+		return nil, jwterrors.ErrUnsupportedKeyType.WithArgs(doc.Kty, doc.Kid)
+	}
+}
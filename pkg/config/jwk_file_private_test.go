@@ -0,0 +1,189 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+)
+
+func b64Encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// TestLoadJWKFileParsesPrivateRSA confirms an RSA JWK carrying n/e/d/p/q
+// reconstructs into a usable, validated *rsa.PrivateKey.
+func TestLoadJWKFileParsesPrivateRSA(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := map[string]string{
+		"kty": "RSA",
+		"kid": "rsa1",
+		"n":   b64Encode(rsaKey.N.Bytes()),
+		"e":   b64Encode(encodeRSAExponent(rsaKey.E)),
+		"d":   b64Encode(rsaKey.D.Bytes()),
+		"p":   b64Encode(rsaKey.Primes[0].Bytes()),
+		"q":   b64Encode(rsaKey.Primes[1].Bytes()),
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := loadJWKFile("rsa1.jwk.json", data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := keys["rsa1"].(*rsa.PrivateKey)
+	if !ok {
+		t.Fatalf("expected *rsa.PrivateKey, got %T", keys["rsa1"])
+	}
+	if got.D.Cmp(rsaKey.D) != 0 || got.N.Cmp(rsaKey.N) != 0 {
+		t.Fatal("reconstructed RSA private key does not match the original")
+	}
+}
+
+// TestLoadJWKFileParsesPrivateECDSA confirms an EC JWK carrying x/y/d
+// reconstructs into a usable *ecdsa.PrivateKey on the right curve.
+func TestLoadJWKFileParsesPrivateECDSA(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := map[string]string{
+		"kty": "EC",
+		"kid": "ec1",
+		"crv": "P-256",
+		"x":   b64Encode(ecKey.X.Bytes()),
+		"y":   b64Encode(ecKey.Y.Bytes()),
+		"d":   b64Encode(ecKey.D.Bytes()),
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := loadJWKFile("ec1.jwk.json", data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := keys["ec1"].(*ecdsa.PrivateKey)
+	if !ok {
+		t.Fatalf("expected *ecdsa.PrivateKey, got %T", keys["ec1"])
+	}
+	if got.Curve != elliptic.P256() || got.D.Cmp(ecKey.D) != 0 {
+		t.Fatal("reconstructed ECDSA private key does not match the original")
+	}
+}
+
+// TestLoadJWKFileParsesPrivateOKP confirms an OKP (Ed25519) JWK carrying the
+// seed in "d" reconstructs into a working ed25519.PrivateKey.
+func TestLoadJWKFileParsesPrivateOKP(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := map[string]string{
+		"kty": "OKP",
+		"kid": "ed1",
+		"crv": "Ed25519",
+		"x":   b64Encode(pub),
+		"d":   b64Encode(priv.Seed()),
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := loadJWKFile("ed1.jwk.json", data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := keys["ed1"].(ed25519.PrivateKey)
+	if !ok {
+		t.Fatalf("expected ed25519.PrivateKey, got %T", keys["ed1"])
+	}
+	if string(got) != string(priv) {
+		t.Fatal("reconstructed Ed25519 private key does not match the original")
+	}
+}
+
+// TestLoadJWKFileSetFallbackKidByIndex confirms a JWK Set whose entries omit
+// "kid" falls back to "<name>" for the first entry and "<name>_<index>" for
+// later ones.
+func TestLoadJWKFileSetFallbackKidByIndex(t *testing.T) {
+	pub1, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub2, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "OKP", "crv": "Ed25519", "x": b64Encode(pub1)},
+			{"kty": "OKP", "crv": "Ed25519", "x": b64Encode(pub2)},
+		},
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := loadJWKFile("keys.jwks.json", data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := keys["keys"]; !exists {
+		t.Fatalf("expected fallback kid \"keys\" for the first entry, got keys: %v", keyNames(keys))
+	}
+	if _, exists := keys["keys_1"]; !exists {
+		t.Fatalf("expected fallback kid \"keys_1\" for the second entry, got keys: %v", keyNames(keys))
+	}
+}
+
+// TestLoadJWKFileRejectsUnsupportedKty confirms an unrecognized "kty" is
+// rejected rather than silently ignored.
+func TestLoadJWKFileRejectsUnsupportedKty(t *testing.T) {
+	doc := map[string]string{"kty": "oct", "kid": "k1"}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadJWKFile("k1.jwk.json", data, false); err == nil {
+		t.Fatal("expected an error for an unsupported kty")
+	}
+}
+
+func keyNames(keys map[string]interface{}) []string {
+	names := make([]string, 0, len(keys))
+	for k := range keys {
+		names = append(names, k)
+	}
+	return names
+}
+
+func encodeRSAExponent(e int) []byte {
+	return []byte{byte(e >> 16), byte(e >> 8), byte(e)}
+}
@@ -0,0 +1,43 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestLoadJWKFileReportsJWKSetExpectationByName confirms a malformed
+// *.jwks.json file gets a parse error that says a JWK Set was expected,
+// rather than the generic single-JWK message.
+func TestLoadJWKFileReportsJWKSetExpectationByName(t *testing.T) {
+	_, err := loadJWKFile("keys.jwks.json", []byte("not json"), false)
+	if err == nil {
+		t.Fatal("expected an error for invalid JSON")
+	}
+	if !strings.Contains(err.Error(), "JWK Set") {
+		t.Fatalf("expected error to mention JWK Set for a .jwks.json file, got: %v", err)
+	}
+}
+
+func TestLoadJWKFileReportsSingleJWKExpectationByName(t *testing.T) {
+	_, err := loadJWKFile("key.jwk.json", []byte("not json"), false)
+	if err == nil {
+		t.Fatal("expected an error for invalid JSON")
+	}
+	if strings.Contains(err.Error(), "JWK Set") {
+		t.Fatalf("expected the generic single-JWK error for a non-.jwks.json file, got: %v", err)
+	}
+}
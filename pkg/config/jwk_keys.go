@@ -0,0 +1,60 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+)
+
+func b64Decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// newRSAPrivateKey assembles an *rsa.PrivateKey out of its raw JWK
+// components and precomputes its CRT values.
+func newRSAPrivateKey(n, e, d, p, q []byte) (*rsa.PrivateKey, error) {
+	key := &rsa.PrivateKey{
+		PublicKey: rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		},
+		D:      new(big.Int).SetBytes(d),
+		Primes: []*big.Int{new(big.Int).SetBytes(p), new(big.Int).SetBytes(q)},
+	}
+	key.Precompute()
+	if err := key.Validate(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// newECDSAPrivateKey pairs a public key parsed from x/y with the scalar d.
+func newECDSAPrivateKey(pub interface{}, d []byte) *ecdsa.PrivateKey {
+	pk := pub.(*ecdsa.PublicKey)
+	return &ecdsa.PrivateKey{
+		PublicKey: *pk,
+		D:         new(big.Int).SetBytes(d),
+	}
+}
+
+// ed25519NewKeyFromSeed turns a JWK "d" (the 32-byte seed) into a full
+// 64-byte ed25519.PrivateKey.
+func ed25519NewKeyFromSeed(seed []byte) ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed(seed)
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+)
+
+func inlineEd25519JWK(t *testing.T, kid string) string {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := map[string]string{
+		"kty": "OKP",
+		"kid": kid,
+		"crv": "Ed25519",
+		"x":   base64.RawURLEncoding.EncodeToString(pub),
+		"d":   base64.RawURLEncoding.EncodeToString(priv.Seed()),
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// TestLoadKeysRejectsPrivateJWKWhenVerifyOnly confirms TokenJWKSVerifyOnly
+// actually reaches loadJWKFile through the config-driven load path, not
+// just when called directly.
+func TestLoadKeysRejectsPrivateJWKWhenVerifyOnly(t *testing.T) {
+	inline := inlineEd25519JWK(t, "v1")
+
+	c := &CommonTokenConfig{}
+	c.TokenJWKSInline = inline
+	c.TokenJWKSVerifyOnly = true
+	if err := c.LoadKeys(); err == nil {
+		t.Fatal("expected LoadKeys to reject private JWK material when TokenJWKSVerifyOnly is set")
+	}
+}
+
+// TestLoadKeysAllowsPrivateJWKWhenNotVerifyOnly confirms the default
+// (TokenJWKSVerifyOnly unset) still loads private key material, so signing
+// configurations aren't affected by this flag.
+func TestLoadKeysAllowsPrivateJWKWhenNotVerifyOnly(t *testing.T) {
+	inline := inlineEd25519JWK(t, "v1")
+
+	c := &CommonTokenConfig{}
+	c.TokenJWKSInline = inline
+	if err := c.LoadKeys(); err != nil {
+		t.Fatalf("expected LoadKeys to succeed, got: %v", err)
+	}
+	if _, exists := c.tokenKeys["v1"]; !exists {
+		t.Fatal("expected key \"v1\" to be loaded")
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/greenpau/caddy-auth-jwt/pkg/jwks"
+)
+
+// DefaultJWKSPath is the well-known path the JWKS endpoint is served at
+// unless the caller asks for a different one.
+const DefaultJWKSPath = "/.well-known/jwks.json"
+
+// GetKeySet builds a JWKS document out of the locally configured public
+// keys. Private keys held in tokenKeys (used for signing) are reduced to
+// their public half; the "0" default alias is skipped so it doesn't appear
+// twice under its real kid.
+func (c *CommonTokenConfig) GetKeySet() (*jwks.KeySet, error) {
+	c.keysMu.RLock()
+	defer c.keysMu.RUnlock()
+	ks := jwks.NewKeySet()
+	for kid, key := range c.tokenKeys {
+		if kid == defaultKeyID {
+			continue
+		}
+		if err := ks.AddKey(kid, key); err != nil {
+			return nil, err
+		}
+	}
+	return ks, nil
+}
+
+// ServeJWKS writes the configuration's JWKS document to w. It is meant to be
+// called from the handler registered at the configured JWKS path (see
+// DefaultJWKSPath).
+func (c *CommonTokenConfig) ServeJWKS(w http.ResponseWriter) error {
+	ks, err := c.GetKeySet()
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(ks)
+}
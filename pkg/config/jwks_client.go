@@ -0,0 +1,285 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	jwterrors "github.com/greenpau/caddy-auth-jwt/pkg/errors"
+	"github.com/greenpau/caddy-auth-jwt/pkg/jwks"
+)
+
+// GetVerificationKey returns the public key a validator should use to check
+// a token carrying the given kid and alg header, checking locally
+// configured keys before falling back to the remote JWKS document at
+// TokenJWKSURL, if one is configured. alg is validated against
+// TokenSignMethod first, so a token can't substitute a weaker or unexpected
+// algorithm for the one the configuration was pinned to.
+func (c *CommonTokenConfig) GetVerificationKey(kid, alg string) (interface{}, error) {
+	if err := c.ValidateSignMethodAlgorithm(alg); err != nil {
+		return nil, err
+	}
+
+	c.keysMu.RLock()
+	key, exists := c.tokenKeys[kid]
+	expiresAt, hasExpiry := c.keyExpiresAt[kid]
+	c.keysMu.RUnlock()
+	if exists && (!hasExpiry || time.Now().Before(expiresAt)) {
+		return key, nil
+	}
+	if !c.HasJWKSURL() {
+		return nil, jwterrors.ErrJWKSKeyNotFound.WithArgs(kid)
+	}
+
+	c.remoteKeysMu.Lock()
+	if c.remoteKeys == nil {
+		c.remoteKeys = newRemoteKeySet(c.TokenJWKSURL, time.Duration(c.TokenJWKSRefreshInterval)*time.Second)
+	}
+	remoteKeys := c.remoteKeys
+	c.remoteKeysMu.Unlock()
+
+	remoteKey, err := remoteKeys.GetKey(kid)
+	if err != nil {
+		return nil, err
+	}
+	if wantCurve, err := GetSignMethodCurve(c.TokenSignMethod); err == nil {
+		if err := validateECDSAKeyCurve(remoteKey, wantCurve); err != nil {
+			return nil, err
+		}
+	}
+	return remoteKey, nil
+}
+
+// minJWKSRefetchInterval rate-limits refetching the remote document on an
+// unknown kid, so a stream of tokens with bogus kids can't be used to hammer
+// the JWKS endpoint.
+const minJWKSRefetchInterval = 5 * time.Second
+
+// remoteKeySet caches public keys fetched from a TokenJWKSURL document.
+type remoteKeySet struct {
+	mu          sync.RWMutex
+	url         string
+	client      *http.Client
+	keys        map[string]interface{}
+	expiresAt   time.Time
+	lastFetched time.Time
+	// refreshInterval, if positive, is the operator-configured
+	// TokenJWKSRefreshInterval and overrides whatever Cache-Control/Expires
+	// says on every fetched response.
+	refreshInterval time.Duration
+}
+
+// newRemoteKeySet returns a client for the given JWKS URL. The caller's TLS
+// settings, if any, are left to http.DefaultTransport, which verifies
+// certificates unless the environment overrides it. refreshInterval, when
+// positive, pins the cache lifetime instead of deriving it from the
+// response headers.
+func newRemoteKeySet(url string, refreshInterval time.Duration) *remoteKeySet {
+	return &remoteKeySet{
+		url:             url,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		keys:            make(map[string]interface{}),
+		refreshInterval: refreshInterval,
+	}
+}
+
+// GetKey returns the public key for kid, fetching (or refreshing) the
+// remote document as needed.
+func (r *remoteKeySet) GetKey(kid string) (interface{}, error) {
+	r.mu.RLock()
+	key, exists := r.keys[kid]
+	fresh := time.Now().Before(r.expiresAt)
+	lastFetched := r.lastFetched
+	r.mu.RUnlock()
+
+	if exists && fresh {
+		return key, nil
+	}
+	if !lastFetched.IsZero() && time.Since(lastFetched) < minJWKSRefetchInterval {
+		if exists {
+			return key, nil
+		}
+		return nil, jwterrors.ErrJWKSKeyNotFound.WithArgs(kid)
+	}
+	if err := r.refresh(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	key, exists = r.keys[kid]
+	r.mu.RUnlock()
+	if !exists {
+		return nil, jwterrors.ErrJWKSKeyNotFound.WithArgs(kid)
+	}
+	return key, nil
+}
+
+func (r *remoteKeySet) refresh() error {
+	resp, err := r.client.Get(r.url)
+	if err != nil {
+		return jwterrors.ErrJWKSFetchFailed.WithArgs(r.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return jwterrors.ErrJWKSFetchFailed.WithArgs(r.url, resp.Status)
+	}
+
+	var doc jwks.KeySet
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return jwterrors.ErrJWKSFetchFailed.WithArgs(r.url, err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, k := range doc.Keys {
+		pub, err := parseJWKPublicKey(k)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+
+	lifetime := r.refreshInterval
+	if lifetime <= 0 {
+		lifetime = cacheLifetime(resp.Header)
+	}
+
+	r.mu.Lock()
+	r.keys = keys
+	r.lastFetched = time.Now()
+	r.expiresAt = r.lastFetched.Add(lifetime)
+	r.mu.Unlock()
+	return nil
+}
+
+// cacheLifetime derives how long a JWKS response may be cached from its
+// Cache-Control max-age, falling back to Expires, and finally a conservative
+// default.
+func cacheLifetime(h http.Header) time.Duration {
+	const defaultLifetime = 5 * time.Minute
+	if cc := h.Get("Cache-Control"); cc != "" {
+		for _, directive := range splitCacheControl(cc) {
+			if age, ok := parseMaxAge(directive); ok {
+				return time.Duration(age) * time.Second
+			}
+		}
+	}
+	if exp := h.Get("Expires"); exp != "" {
+		if t, err := http.ParseTime(exp); err == nil {
+			if d := time.Until(t); d > 0 {
+				return d
+			}
+		}
+	}
+	return defaultLifetime
+}
+
+func splitCacheControl(cc string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(cc); i++ {
+		if cc[i] == ',' {
+			parts = append(parts, cc[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, cc[start:])
+	return parts
+}
+
+func parseMaxAge(directive string) (int, bool) {
+	const prefix = "max-age="
+	directive = trimSpace(directive)
+	if len(directive) <= len(prefix) || directive[:len(prefix)] != prefix {
+		return 0, false
+	}
+	age, err := strconv.Atoi(directive[len(prefix):])
+	if err != nil {
+		return 0, false
+	}
+	return age, true
+}
+
+func trimSpace(s string) string {
+	for len(s) > 0 && s[0] == ' ' {
+		s = s[1:]
+	}
+	for len(s) > 0 && s[len(s)-1] == ' ' {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+func parseJWKPublicKey(k jwks.Key) (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, jwterrors.ErrUnsupportedKeyType.WithArgs(k.Crv, k.Kid)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, jwterrors.ErrUnsupportedKeyType.WithArgs(k.Crv, k.Kid)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, jwterrors.ErrUnsupportedKeyType.WithArgs(k.Kty, k.Kid)
+	}
+}
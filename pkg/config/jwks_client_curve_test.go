@@ -0,0 +1,76 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func ecdsaJWKSServer(t *testing.T, kid string, curve elliptic.Curve) *httptest.Server {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crv := map[string]string{elliptic.P256().Params().Name: "P-256", elliptic.P384().Params().Name: "P-384", elliptic.P521().Params().Name: "P-521"}[curve.Params().Name]
+	doc := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "EC",
+			"kid": kid,
+			"crv": crv,
+			"x":   base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+			"y":   base64.RawURLEncoding.EncodeToString(key.Y.Bytes()),
+		}},
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(doc)
+	}))
+}
+
+// TestGetVerificationKeyRejectsMismatchedRemoteCurve confirms a remote JWKS
+// document serving the wrong curve for a configured ES256 method is
+// rejected the same way a mismatched local key is (TestAddKeyRejectsMismatchedCurve).
+func TestGetVerificationKeyRejectsMismatchedRemoteCurve(t *testing.T) {
+	srv := ecdsaJWKSServer(t, "r1", elliptic.P384())
+	defer srv.Close()
+
+	c := &CommonTokenConfig{TokenSignMethod: MethodES256}
+	c.TokenJWKSURL = srv.URL
+
+	if _, err := c.GetVerificationKey("r1", MethodES256); err == nil {
+		t.Fatal("expected a P-384 remote key to be rejected under an ES256 (P-256) configuration")
+	}
+}
+
+// TestGetVerificationKeyAcceptsMatchingRemoteCurve is the positive
+// counterpart: a remote key on the correct curve is returned normally.
+func TestGetVerificationKeyAcceptsMatchingRemoteCurve(t *testing.T) {
+	srv := ecdsaJWKSServer(t, "r1", elliptic.P256())
+	defer srv.Close()
+
+	c := &CommonTokenConfig{TokenSignMethod: MethodES256}
+	c.TokenJWKSURL = srv.URL
+
+	if _, err := c.GetVerificationKey("r1", MethodES256); err != nil {
+		t.Fatalf("expected a P-256 remote key to be accepted under an ES256 configuration, got: %v", err)
+	}
+}
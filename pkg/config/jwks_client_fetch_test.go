@@ -0,0 +1,151 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingJWKSServer serves doc and counts how many times it was fetched, so
+// tests can assert on cache hits/misses without timing fragility.
+func countingJWKSServer(t *testing.T, doc map[string]interface{}, header http.Header) (*httptest.Server, *int32) {
+	t.Helper()
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		for k, vs := range header {
+			for _, v := range vs {
+				w.Header().Add(k, v)
+			}
+		}
+		json.NewEncoder(w).Encode(doc)
+	}))
+	return srv, &hits
+}
+
+// TestRemoteKeySetCachesWithinLifetime confirms a second GetKey call within
+// the cached lifetime does not refetch the document.
+func TestRemoteKeySetCachesWithinLifetime(t *testing.T) {
+	doc := map[string]interface{}{"keys": []map[string]string{{"kty": "OKP", "kid": "k1", "crv": "Ed25519", "x": "AQIDBA"}}}
+	srv, hits := countingJWKSServer(t, doc, http.Header{"Cache-Control": {"max-age=3600"}})
+	defer srv.Close()
+
+	rks := newRemoteKeySet(srv.URL, 0)
+	if _, err := rks.GetKey("k1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rks.GetKey("k1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(hits); got != 1 {
+		t.Fatalf("expected exactly one fetch while the cache is fresh, got %d", got)
+	}
+}
+
+// TestRemoteKeySetRefreshesAfterExpiry confirms an expired cache triggers a
+// refetch on the next GetKey call, once the minJWKSRefetchInterval rate
+// limit has also elapsed. lastFetched is backdated directly rather than
+// slept past, so the test doesn't have to wait out the real interval.
+func TestRemoteKeySetRefreshesAfterExpiry(t *testing.T) {
+	doc := map[string]interface{}{"keys": []map[string]string{{"kty": "OKP", "kid": "k1", "crv": "Ed25519", "x": "AQIDBA"}}}
+	srv, hits := countingJWKSServer(t, doc, nil)
+	defer srv.Close()
+
+	rks := newRemoteKeySet(srv.URL, time.Nanosecond)
+	if _, err := rks.GetKey("k1"); err != nil {
+		t.Fatal(err)
+	}
+
+	rks.mu.Lock()
+	rks.lastFetched = time.Now().Add(-2 * minJWKSRefetchInterval)
+	rks.expiresAt = time.Now().Add(-time.Second)
+	rks.mu.Unlock()
+
+	if _, err := rks.GetKey("k1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(hits); got != 2 {
+		t.Fatalf("expected a refetch once the cache expired, got %d fetch(es)", got)
+	}
+}
+
+// TestRemoteKeySetRateLimitsRefetchOnUnknownKid confirms a second lookup for
+// a kid the document doesn't have, issued right after the first, does not
+// hammer the JWKS endpoint again within minJWKSRefetchInterval.
+func TestRemoteKeySetRateLimitsRefetchOnUnknownKid(t *testing.T) {
+	doc := map[string]interface{}{"keys": []map[string]string{{"kty": "OKP", "kid": "k1", "crv": "Ed25519", "x": "AQIDBA"}}}
+	srv, hits := countingJWKSServer(t, doc, http.Header{"Cache-Control": {"max-age=3600"}})
+	defer srv.Close()
+
+	rks := newRemoteKeySet(srv.URL, 0)
+	if _, err := rks.GetKey("missing"); err == nil {
+		t.Fatal("expected an error for a kid absent from the document")
+	}
+	if _, err := rks.GetKey("missing"); err == nil {
+		t.Fatal("expected an error for a kid absent from the document")
+	}
+	if got := atomic.LoadInt32(hits); got != 1 {
+		t.Fatalf("expected the second lookup to be rate-limited rather than refetching, got %d fetch(es)", got)
+	}
+}
+
+// TestCacheLifetimeParsesCacheControlMaxAge confirms cacheLifetime prefers a
+// Cache-Control max-age directive over Expires and the default.
+func TestCacheLifetimeParsesCacheControlMaxAge(t *testing.T) {
+	h := http.Header{}
+	h.Set("Cache-Control", "public, max-age=120")
+	h.Set("Expires", time.Now().Add(time.Hour).Format(http.TimeFormat))
+	if got := cacheLifetime(h); got != 120*time.Second {
+		t.Fatalf("expected 120s from max-age, got %v", got)
+	}
+}
+
+// TestCacheLifetimeFallsBackToExpires confirms cacheLifetime falls back to
+// the Expires header when Cache-Control carries no max-age.
+func TestCacheLifetimeFallsBackToExpires(t *testing.T) {
+	h := http.Header{}
+	h.Set("Expires", time.Now().Add(30*time.Second).Format(http.TimeFormat))
+	got := cacheLifetime(h)
+	if got <= 0 || got > 30*time.Second {
+		t.Fatalf("expected a positive lifetime derived from Expires and at most 30s, got %v", got)
+	}
+}
+
+// TestCacheLifetimeDefaultsWithNoHeaders confirms cacheLifetime falls back to
+// its conservative default when neither header is present.
+func TestCacheLifetimeDefaultsWithNoHeaders(t *testing.T) {
+	if got := cacheLifetime(http.Header{}); got != 5*time.Minute {
+		t.Fatalf("expected the 5-minute default, got %v", got)
+	}
+}
+
+// TestRemoteKeySetFetchFailureSurfacesError confirms a non-200 response is
+// reported as an error rather than silently caching an empty key set.
+func TestRemoteKeySetFetchFailureSurfacesError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	rks := newRemoteKeySet(srv.URL, 0)
+	if _, err := rks.GetKey("k1"); err == nil {
+		t.Fatal("expected an error when the JWKS endpoint returns a non-200 status")
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestGetKeySetSkipsDefaultKid confirms the "0" default-kid alias is left
+// out of the published document, so a key added under both its real kid and
+// "0" doesn't appear twice.
+func TestGetKeySetSkipsDefaultKid(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &CommonTokenConfig{}
+	if err := c.AddKey(defaultKeyID, pub); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddKey("real-kid", pub); err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err := c.GetKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks.Keys) != 1 {
+		t.Fatalf("expected exactly one key (the default kid skipped), got %d", len(ks.Keys))
+	}
+	if ks.Keys[0].Kid != "real-kid" {
+		t.Fatalf("expected the published key to be \"real-kid\", got %q", ks.Keys[0].Kid)
+	}
+}
+
+// TestServeJWKSWritesJSONDocument confirms ServeJWKS writes a JSON
+// content-typed JWKS document derived from the configured keys.
+func TestServeJWKSWritesJSONDocument(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &CommonTokenConfig{}
+	if err := c.AddKey("k1", pub); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	if err := c.ServeJWKS(w); err != nil {
+		t.Fatal(err)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("expected Content-Type application/json, got %q", ct)
+	}
+	if !strings.Contains(w.Body.String(), "k1") {
+		t.Fatalf("expected the response body to mention kid \"k1\", got: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// loadedKey pairs key material with the time it should be considered
+// created, so GetPrivateKey's newest-key selection reflects actual key age
+// rather than the moment this process happened to load it. This is only as
+// reliable as the source file's mtime: a deploy method that preserves
+// timestamps across a key rotation (e.g. rsync -a, cp -p) will leave a
+// rotated key looking older than it is.
+type loadedKey struct {
+	Key       interface{}
+	CreatedAt time.Time
+}
+
+// keySourceSkip records a directory-scan file that failed to parse as a key,
+// so the caller can decide whether that's a hard error (the initial load)
+// or merely observable (a KeyRotator rescan) instead of silently shrinking
+// the key set.
+type keySourceSkip struct {
+	Path string
+	Err  error
+}
+
+// keySourceResult is loadKeySources' return value: the keys it could parse,
+// plus any files it had to skip.
+type keySourceResult struct {
+	Keys    map[string]loadedKey
+	Skipped []keySourceSkip
+}
+
+// loadKeySources re-reads the directory and JWKS-file sources a KeyRotator
+// rescans on each tick. Unlike LoadKeys, it never mutates c: it returns a
+// fresh snapshot the caller merges in under keysMu. Each key's CreatedAt is
+// its source file's mtime where one exists; inline JWKS key material has no
+// file to stat and falls back to the caller's load time. A directory-scan
+// file that fails to parse as a key is recorded in Skipped rather than
+// silently dropped.
+func (c *CommonTokenConfig) loadKeySources() (keySourceResult, error) {
+	result := keySourceResult{Keys: make(map[string]loadedKey)}
+
+	for _, dir := range []string{c.TokenRSADir, c.TokenECDSADir, c.TokenEdDSADir} {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return keySourceResult{}, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			data, createdAt, err := readFileWithModTime(path)
+			if err != nil {
+				return keySourceResult{}, err
+			}
+			kid := strippedKeyFileName(entry.Name())
+			key, err := parseAnyPrivateOrPublicKey(data)
+			if err != nil {
+				result.Skipped = append(result.Skipped, keySourceSkip{Path: path, Err: err})
+				continue
+			}
+			result.Keys[kid] = loadedKey{Key: key, CreatedAt: createdAt}
+		}
+	}
+
+	if c.TokenJWKSFile != "" {
+		data, createdAt, err := readFileWithModTime(c.TokenJWKSFile)
+		if err != nil {
+			return keySourceResult{}, err
+		}
+		fileKeys, err := loadJWKFile(c.TokenJWKSFile, data, c.TokenJWKSVerifyOnly)
+		if err != nil {
+			return keySourceResult{}, err
+		}
+		for kid, key := range fileKeys {
+			result.Keys[kid] = loadedKey{Key: key, CreatedAt: createdAt}
+		}
+	}
+
+	if c.TokenJWKSInline != "" {
+		inlineKeys, err := loadJWKFile("inline", []byte(c.TokenJWKSInline), c.TokenJWKSVerifyOnly)
+		if err != nil {
+			return keySourceResult{}, err
+		}
+		now := time.Now()
+		for kid, key := range inlineKeys {
+			result.Keys[kid] = loadedKey{Key: key, CreatedAt: now}
+		}
+	}
+
+	return result, nil
+}
+
+func strippedKeyFileName(name string) string {
+	ext := filepath.Ext(name)
+	switch ext {
+	case ".key", ".pem", ".pub":
+		return name[:len(name)-len(ext)]
+	}
+	return name
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestLoadKeysFailsOnUnparseableDirectoryFile confirms a bad key file in a
+// watched directory fails LoadKeys outright rather than silently shrinking
+// the key set.
+func TestLoadKeysFailsOnUnparseableDirectoryFile(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519KeyFile(t, dir, "good.key")
+	if err := os.WriteFile(filepath.Join(dir, "bad.key"), []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &CommonTokenConfig{}
+	c.TokenEdDSADir = dir
+	if err := c.LoadKeys(); err == nil {
+		t.Fatal("expected LoadKeys to fail on an unparseable key file in the directory")
+	}
+}
+
+// TestKeyRotatorRescanReportsSkippedFile confirms a rescan that hits an
+// unparseable file in the directory emits a "skipped" event and still picks
+// up the keys it could parse, instead of aborting or silently dropping it.
+func TestKeyRotatorRescanReportsSkippedFile(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519KeyFile(t, dir, "a.key")
+
+	c := &CommonTokenConfig{}
+	c.TokenEdDSADir = dir
+	if err := c.LoadKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "bad.key"), []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	writeEd25519KeyFile(t, dir, "c.key")
+
+	events := make(chan KeyRotationEvent, 8)
+	rotator := NewKeyRotator(c, events)
+	rotator.rescan()
+
+	var sawSkip, sawAdd bool
+	for {
+		select {
+		case ev := <-events:
+			switch ev.Action {
+			case "skipped":
+				sawSkip = true
+				if ev.Err == nil {
+					t.Fatal("expected skipped event to carry the parse error")
+				}
+			case "added":
+				if ev.KeyID == "c" {
+					sawAdd = true
+				}
+			}
+			continue
+		default:
+		}
+		break
+	}
+
+	if !sawSkip {
+		t.Fatal("expected a \"skipped\" event for the unparseable file")
+	}
+	if !sawAdd {
+		t.Fatal("expected key \"c\" to still be picked up despite the bad file")
+	}
+}
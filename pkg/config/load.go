@@ -0,0 +1,214 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	jwterrors "github.com/greenpau/caddy-auth-jwt/pkg/errors"
+)
+
+// loadEnvDefaults copies any JWT_* environment variables into the
+// corresponding config field, without overwriting a field the caller
+// already set explicitly. Config always wins over environment when both are
+// present.
+func (c *CommonTokenConfig) loadEnvDefaults() {
+	setFromEnv(&c.TokenRSADir, EnvTokenRSADir)
+	setFromEnv(&c.TokenRSAFile, EnvTokenRSAFile)
+	setFromEnv(&c.TokenRSAKey, EnvTokenRSAKey)
+	setFromEnv(&c.TokenECDSADir, EnvTokenECDSADir)
+	setFromEnv(&c.TokenECDSAFile, EnvTokenECDSAFile)
+	setFromEnv(&c.TokenECDSAKey, EnvTokenECDSAKey)
+	setFromEnv(&c.TokenEdDSADir, EnvTokenEdDSADir)
+	setFromEnv(&c.TokenEdDSAFile, EnvTokenEdDSAFile)
+	setFromEnv(&c.TokenEdDSAKey, EnvTokenEdDSAKey)
+	setFromEnv(&c.TokenSecret, EnvTokenSecret)
+	setFromEnv(&c.TokenJWKSFile, EnvTokenJWKSFile)
+	setFromEnv(&c.TokenJWKSURL, EnvTokenJWKSURL)
+	setFromEnv(&c.TokenName, EnvTokenName)
+	if !c.TokenJWKSVerifyOnly {
+		if v := os.Getenv(EnvTokenJWKSVerifyOnly); v != "" {
+			if b, err := strconv.ParseBool(v); err == nil {
+				c.TokenJWKSVerifyOnly = b
+			}
+		}
+	}
+	if c.TokenLifetime == 0 {
+		if v := os.Getenv(EnvTokenLifetime); v != "" {
+			if n, err := strconv.Atoi(v); err == nil {
+				c.TokenLifetime = n
+			}
+		}
+	}
+}
+
+func setFromEnv(field *string, envVar string) {
+	if *field != "" {
+		return
+	}
+	if v := os.Getenv(envVar); v != "" {
+		*field = v
+	}
+}
+
+// load populates tokenKeys from every source CommonTokenConfig supports:
+// environment variables, TokenSecret, the TokenRSADir/TokenECDSADir/
+// TokenEdDSADir directories, their Files/Keys maps and single File/Key
+// fields, and TokenJWKSFile/TokenJWKSInline. It is invoked by LoadKeys the
+// first time tokenKeys is empty.
+func (c *CommonTokenConfig) load() error {
+	c.loadEnvDefaults()
+
+	if c.TokenSecret != "" {
+		if err := c.AddKey(defaultKeyID, c.TokenSecret); err != nil {
+			return err
+		}
+	}
+
+	// The special single file/key fields map to the "0" kid and are
+	// evaluated first, so an explicit "0" entry in a Files/Keys map below
+	// can still override them.
+	if err := c.loadSingleKey(c.TokenRSAFile, c.TokenRSAKey); err != nil {
+		return err
+	}
+	if err := c.loadSingleKey(c.TokenECDSAFile, c.TokenECDSAKey); err != nil {
+		return err
+	}
+	if err := c.loadSingleKey(c.TokenEdDSAFile, c.TokenEdDSAKey); err != nil {
+		return err
+	}
+
+	if err := c.loadKeyMaps(c.TokenRSAFiles, c.TokenRSAKeys); err != nil {
+		return err
+	}
+	if err := c.loadKeyMaps(c.TokenECDSAFiles, c.TokenECDSAKeys); err != nil {
+		return err
+	}
+	if err := c.loadKeyMaps(c.TokenEdDSAFiles, c.TokenEdDSAKeys); err != nil {
+		return err
+	}
+
+	result, err := c.loadKeySources()
+	if err != nil {
+		return err
+	}
+	// A directory-scan file that fails to parse is a hard error here, same
+	// as a bad TokenRSAFiles/TokenRSAKeys entry above: a malformed or
+	// partially-written key file should stop startup, not silently shrink
+	// the key set. KeyRotator.rescan, which also calls loadKeySources, opts
+	// out of this and reports the same Skipped entries as events instead,
+	// since a background rescan must not abort the process over one file.
+	if len(result.Skipped) > 0 {
+		skip := result.Skipped[0]
+		return jwterrors.ErrInvalidKeyFile.WithArgs(skip.Path, skip.Err)
+	}
+	for kid, lk := range result.Keys {
+		if err := c.AddKeyWithCreatedAt(kid, lk.Key, lk.CreatedAt); err != nil {
+			return err
+		}
+	}
+
+	if len(c.tokenKeys) == 0 {
+		return jwterrors.ErrRSAKeysNotFound
+	}
+	if c.TokenSignMethod == "" {
+		c.TokenSignMethod = inferSignMethodFromKeys(c.tokenKeys)
+	}
+
+	if err := c.loadEncryptionKeySources(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// loadSingleKey loads the special TokenXXXFile/TokenXXXKey pair under the
+// default kid, preferring the file when both are set. A file-sourced key is
+// stamped with the file's mtime, matching the directory-scan path in
+// keysource.go, so GetPrivateKey's newest-key selection is consistent no
+// matter which of the equivalent config fields a key was loaded through.
+func (c *CommonTokenConfig) loadSingleKey(file, inlinePEM string) error {
+	switch {
+	case file != "":
+		data, createdAt, err := readFileWithModTime(file)
+		if err != nil {
+			return err
+		}
+		key, err := parseAnyPrivateOrPublicKey(data)
+		if err != nil {
+			return err
+		}
+		return c.AddKeyWithCreatedAt(defaultKeyID, key, createdAt)
+	case inlinePEM != "":
+		key, err := parseAnyPrivateOrPublicKey([]byte(inlinePEM))
+		if err != nil {
+			return err
+		}
+		return c.AddKey(defaultKeyID, key)
+	default:
+		return nil
+	}
+}
+
+// loadKeyMaps loads the <kid>-to-path and <kid>-to-PEM maps used for RSA,
+// ECDSA, and Ed25519 keys alike, stamping file-sourced keys with their
+// file's mtime (see loadSingleKey).
+func (c *CommonTokenConfig) loadKeyMaps(files, pems map[string]string) error {
+	for kid, path := range files {
+		data, createdAt, err := readFileWithModTime(path)
+		if err != nil {
+			return err
+		}
+		key, err := parseAnyPrivateOrPublicKey(data)
+		if err != nil {
+			return err
+		}
+		if err := c.AddKeyWithCreatedAt(kid, key, createdAt); err != nil {
+			return err
+		}
+	}
+	for kid, pem := range pems {
+		key, err := parseAnyPrivateOrPublicKey([]byte(pem))
+		if err != nil {
+			return err
+		}
+		if err := c.AddKey(kid, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFileWithModTime reads path in a single open/stat/read sequence so the
+// returned mtime always matches the bytes actually read, avoiding a
+// separate-Stat-then-ReadFile TOCTOU.
+func readFileWithModTime(path string) (data []byte, modTime time.Time, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err = io.ReadAll(f)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return data, info.ModTime(), nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestLoadSingleKeyUsesFileModTime confirms the single-file path (here
+// TokenEdDSAFile) stamps keyCreatedAt from the file's mtime, not process
+// load time, the same way loadKeySources' directory scan does.
+func TestLoadSingleKeyUsesFileModTime(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "0.key")
+	writeEd25519KeyFile(t, dir, "0.key")
+
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &CommonTokenConfig{}
+	c.TokenEdDSAFile = path
+	if err := c.LoadKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := c.keyCreatedAt[defaultKeyID]
+	if !got.Equal(old) {
+		t.Fatalf("keyCreatedAt[%q] = %v, want file mtime %v", defaultKeyID, got, old)
+	}
+}
+
+// TestLoadKeyMapsUsesFileModTime is the TestLoadSingleKeyUsesFileModTime
+// equivalent for the <kid>-to-path map form.
+func TestLoadKeyMapsUsesFileModTime(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519KeyFile(t, dir, "a.key")
+	path := filepath.Join(dir, "a.key")
+
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &CommonTokenConfig{}
+	c.TokenEdDSAFiles = map[string]string{"a": path}
+	if err := c.LoadKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := c.keyCreatedAt["a"]
+	if !got.Equal(old) {
+		t.Fatalf("keyCreatedAt[\"a\"] = %v, want file mtime %v", got, old)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+
+	jwterrors "github.com/greenpau/caddy-auth-jwt/pkg/errors"
+)
+
+// parseAnyPrivateOrPublicKey tries each PEM key format caddy-auth-jwt
+// understands in turn: RSA/ECDSA PKCS#1, SEC1, and PKCS#8 private keys, and
+// PKIX public keys. PKCS#8 is tried last among the private formats since
+// it's also how Ed25519 keys, which have no legacy encoding, are carried.
+func parseAnyPrivateOrPublicKey(data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, jwterrors.ErrInvalidKey
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		switch k := key.(type) {
+		case *rsa.PrivateKey, *ecdsa.PrivateKey:
+			return k, nil
+		case ed25519.PrivateKey:
+			return k, nil
+		}
+	}
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		switch k := key.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+			return k, nil
+		case ed25519.PublicKey:
+			return k, nil
+		}
+	}
+	return nil, jwterrors.ErrInvalidKey
+}
@@ -0,0 +1,162 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"time"
+)
+
+// KeyRotationEvent describes a single observed change to the configured key
+// material, for operators wiring up metrics or logs around key rotation.
+type KeyRotationEvent struct {
+	// Action is one of "added", "retired", "expired", or "skipped". A
+	// "skipped" event carries the offending path in KeyID and a non-nil Err
+	// instead of a kid, e.g. a key file dropped into a watched directory
+	// that failed to parse.
+	Action string
+	KeyID  string
+	Time   time.Time
+	Err    error
+}
+
+// KeyRotator periodically rescans the configured key sources and swaps them
+// into a CommonTokenConfig without interrupting concurrent signing or
+// verification.
+type KeyRotator struct {
+	config   *CommonTokenConfig
+	interval time.Duration
+	overlap  time.Duration
+	events   chan<- KeyRotationEvent
+	stop     chan struct{}
+}
+
+// NewKeyRotator builds a KeyRotator for c. Rotation events are sent to
+// events if non-nil; callers that don't care about observability may pass
+// nil. NewKeyRotator does not start the background loop — call Start for
+// that.
+func NewKeyRotator(c *CommonTokenConfig, events chan<- KeyRotationEvent) *KeyRotator {
+	return &KeyRotator{
+		config:   c,
+		interval: time.Duration(c.TokenKeyRefreshInterval) * time.Second,
+		overlap:  time.Duration(c.TokenKeyOverlapWindow) * time.Second,
+		events:   events,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start launches the background rescan loop. It is a no-op, returning
+// immediately, if TokenKeyRefreshInterval was not set.
+func (r *KeyRotator) Start() {
+	if r.interval <= 0 {
+		return
+	}
+	go r.run()
+}
+
+// Stop halts the background rescan loop. It is safe to call Stop more than
+// once.
+func (r *KeyRotator) Stop() {
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+}
+
+func (r *KeyRotator) run() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.rescan()
+		}
+	}
+}
+
+// rescan reloads key material via the same sources LoadKeys uses, then
+// merges the result into the live key map: new kids are added immediately,
+// while kids no longer present are kept alive until the overlap window
+// closes so recently signed tokens keep verifying.
+func (r *KeyRotator) rescan() {
+	result, err := r.config.loadKeySources()
+	if err != nil {
+		return
+	}
+	fresh := result.Keys
+	now := time.Now()
+
+	for _, skip := range result.Skipped {
+		r.emit(KeyRotationEvent{Action: "skipped", KeyID: skip.Path, Time: now, Err: skip.Err})
+	}
+
+	r.config.keysMu.Lock()
+	if r.config.tokenKeys == nil {
+		r.config.tokenKeys = make(map[string]interface{})
+	}
+	if r.config.keyExpiresAt == nil {
+		r.config.keyExpiresAt = make(map[string]time.Time)
+	}
+	if r.config.keyCreatedAt == nil {
+		r.config.keyCreatedAt = make(map[string]time.Time)
+	}
+
+	for kid := range r.config.tokenKeys {
+		if kid == defaultKeyID {
+			continue
+		}
+		if _, stillPresent := fresh[kid]; stillPresent {
+			continue
+		}
+		if _, alreadyExpiring := r.config.keyExpiresAt[kid]; alreadyExpiring {
+			continue
+		}
+		r.config.keyExpiresAt[kid] = now.Add(r.overlap)
+		r.emit(KeyRotationEvent{Action: "retired", KeyID: kid, Time: now})
+	}
+
+	for kid, expiresAt := range r.config.keyExpiresAt {
+		if now.Before(expiresAt) {
+			continue
+		}
+		delete(r.config.tokenKeys, kid)
+		delete(r.config.keyExpiresAt, kid)
+		delete(r.config.keyCreatedAt, kid)
+		r.emit(KeyRotationEvent{Action: "expired", KeyID: kid, Time: now})
+	}
+
+	for kid, lk := range fresh {
+		if _, exists := r.config.tokenKeys[kid]; exists {
+			continue
+		}
+		r.config.tokenKeys[kid] = lk.Key
+		r.config.keyCreatedAt[kid] = lk.CreatedAt
+		delete(r.config.keyExpiresAt, kid)
+		r.emit(KeyRotationEvent{Action: "added", KeyID: kid, Time: now})
+	}
+	r.config.keysMu.Unlock()
+}
+
+func (r *KeyRotator) emit(ev KeyRotationEvent) {
+	if r.events == nil {
+		return
+	}
+	select {
+	case r.events <- ev:
+	default:
+	}
+}
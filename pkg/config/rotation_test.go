@@ -0,0 +1,110 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeEd25519KeyFile(t *testing.T, dir, name string) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	if err := os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestKeyRotatorRescanAddsAndRetiresKeys exercises a full rotation cycle: a
+// key removed from the source directory is kept alive for verification until
+// its overlap window elapses, then is dropped on the following rescan.
+func TestKeyRotatorRescanAddsAndRetiresKeys(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519KeyFile(t, dir, "a.key")
+	writeEd25519KeyFile(t, dir, "b.key")
+
+	c := &CommonTokenConfig{}
+	c.TokenEdDSADir = dir
+	if err := c.LoadKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := c.tokenKeys["a"]; !exists {
+		t.Fatal("expected key \"a\" to be loaded")
+	}
+	if _, exists := c.tokenKeys["b"]; !exists {
+		t.Fatal("expected key \"b\" to be loaded")
+	}
+
+	rotator := NewKeyRotator(c, nil)
+	rotator.overlap = 50 * time.Millisecond
+
+	if err := os.Remove(filepath.Join(dir, "b.key")); err != nil {
+		t.Fatal(err)
+	}
+	rotator.rescan()
+
+	if _, exists := c.tokenKeys["b"]; !exists {
+		t.Fatal("expected retired key \"b\" to still verify within its overlap window")
+	}
+	if _, expiring := c.keyExpiresAt["b"]; !expiring {
+		t.Fatal("expected retired key \"b\" to have a pending expiry")
+	}
+
+	time.Sleep(75 * time.Millisecond)
+	rotator.rescan()
+
+	if _, exists := c.tokenKeys["b"]; exists {
+		t.Fatal("expected key \"b\" to be dropped once its overlap window elapsed")
+	}
+	if _, exists := c.tokenKeys["a"]; !exists {
+		t.Fatal("expected untouched key \"a\" to remain")
+	}
+}
+
+// TestKeyRotatorRescanAddsNewKey confirms a key added to the source
+// directory after the initial load is picked up by the next rescan.
+func TestKeyRotatorRescanAddsNewKey(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519KeyFile(t, dir, "a.key")
+
+	c := &CommonTokenConfig{}
+	c.TokenEdDSADir = dir
+	if err := c.LoadKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeEd25519KeyFile(t, dir, "c.key")
+
+	rotator := NewKeyRotator(c, nil)
+	rotator.rescan()
+
+	if _, exists := c.tokenKeys["c"]; !exists {
+		t.Fatal("expected newly added key \"c\" to be picked up by rescan")
+	}
+}
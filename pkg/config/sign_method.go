@@ -0,0 +1,172 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+
+	jwterrors "github.com/greenpau/caddy-auth-jwt/pkg/errors"
+)
+
+// The following constants are the recognized values of TokenSignMethod. They
+// mirror the JWS "alg" header values defined in RFC 7518.
+const (
+	MethodHS256 = "HS256"
+	MethodHS384 = "HS384"
+	MethodHS512 = "HS512"
+	MethodRS256 = "RS256"
+	MethodRS384 = "RS384"
+	MethodRS512 = "RS512"
+	MethodPS256 = "PS256"
+	MethodPS384 = "PS384"
+	MethodPS512 = "PS512"
+	MethodES256 = "ES256"
+	MethodES384 = "ES384"
+	MethodES512 = "ES512"
+	MethodEdDSA = "EdDSA"
+)
+
+// signMethods holds the set of TokenSignMethod values CommonTokenConfig
+// accepts.
+var signMethods = map[string]bool{
+	MethodHS256: true,
+	MethodHS384: true,
+	MethodHS512: true,
+	MethodRS256: true,
+	MethodRS384: true,
+	MethodRS512: true,
+	MethodPS256: true,
+	MethodPS384: true,
+	MethodPS512: true,
+	MethodES256: true,
+	MethodES384: true,
+	MethodES512: true,
+	MethodEdDSA: true,
+}
+
+// ecdsaCurves maps an ECDSA TokenSignMethod to the elliptic curve it must be
+// signed/verified with, per RFC 7518 Section 3.4.
+var ecdsaCurves = map[string]elliptic.Curve{
+	MethodES256: elliptic.P256(),
+	MethodES384: elliptic.P384(),
+	MethodES512: elliptic.P521(),
+}
+
+// ValidateSignMethod returns an error if m is not one of the sign methods
+// CommonTokenConfig supports.
+func ValidateSignMethod(m string) error {
+	if !signMethods[m] {
+		return jwterrors.ErrUnsupportedSignMethod.WithArgs(m)
+	}
+	return nil
+}
+
+// GetSignMethodCurve returns the elliptic curve an ECDSA TokenSignMethod is
+// pinned to. It returns an error for sign methods that are not ECDSA-based.
+func GetSignMethodCurve(m string) (elliptic.Curve, error) {
+	curve, exists := ecdsaCurves[m]
+	if !exists {
+		return nil, jwterrors.ErrUnsupportedSignMethod.WithArgs(m)
+	}
+	return curve, nil
+}
+
+// validateECDSAKeyCurve rejects an ECDSA key whose curve does not match the
+// curve required by the configured sign method, e.g. an ES256 configuration
+// must be backed by P-256 keys.
+func validateECDSAKeyCurve(pk interface{}, want elliptic.Curve) error {
+	var curve elliptic.Curve
+	switch k := pk.(type) {
+	case *ecdsa.PrivateKey:
+		curve = k.Curve
+	case *ecdsa.PublicKey:
+		curve = k.Curve
+	default:
+		return nil
+	}
+	if curve != want {
+		return jwterrors.ErrMismatchedSignMethodCurve.WithArgs(curve.Params().Name, want.Params().Name)
+	}
+	return nil
+}
+
+// ValidateSignMethodAlgorithm ensures that the alg header found on a parsed
+// token matches the sign method the configuration was pinned to. Rejecting a
+// mismatch here is what prevents alg-substitution (e.g. a RS256-signed
+// configuration accepting an attacker-forged HS256 token keyed with the
+// public key).
+func (c *CommonTokenConfig) ValidateSignMethodAlgorithm(alg string) error {
+	if c.TokenSignMethod == "" {
+		return nil
+	}
+	if alg != c.TokenSignMethod {
+		return jwterrors.ErrMismatchedSignMethod.WithArgs(alg, c.TokenSignMethod)
+	}
+	return nil
+}
+
+// inferSignMethodFromKeys picks a TokenSignMethod from the concrete type of
+// the loaded keys, for an operator who never set TokenSignMethod explicitly.
+// Without this, ValidateSignMethodAlgorithm's alg-substitution protection
+// would stay opt-in forever, since TokenSignMethod defaults to "". An ECDSA
+// or Ed25519 key maps to exactly one method, so those infer cleanly; an RSA
+// key defaults to RS256 and a shared secret to HS256, the conventional
+// choice among the several methods a key of that type could back. Keys that
+// would infer different methods (e.g. an ECDSA key next to a shared secret,
+// or P-256 next to P-384) leave the result empty, same as before this
+// inference existed, since there's no single alg to pin to in that case.
+func inferSignMethodFromKeys(keys map[string]interface{}) string {
+	var method string
+	for _, k := range keys {
+		var candidate string
+		switch key := k.(type) {
+		case *ecdsa.PrivateKey:
+			candidate = ecdsaSignMethod(key.Curve)
+		case *ecdsa.PublicKey:
+			candidate = ecdsaSignMethod(key.Curve)
+		case ed25519.PrivateKey, ed25519.PublicKey:
+			candidate = MethodEdDSA
+		case *rsa.PrivateKey, *rsa.PublicKey:
+			candidate = MethodRS256
+		case string:
+			candidate = MethodHS256
+		default:
+			return ""
+		}
+		if candidate == "" {
+			return ""
+		}
+		if method == "" {
+			method = candidate
+		} else if method != candidate {
+			return ""
+		}
+	}
+	return method
+}
+
+// ecdsaSignMethod reverses ecdsaCurves, returning the TokenSignMethod pinned
+// to curve, or "" if curve isn't one of the ones this package recognizes.
+func ecdsaSignMethod(curve elliptic.Curve) string {
+	for m, c := range ecdsaCurves {
+		if c == curve {
+			return m
+		}
+	}
+	return ""
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"testing"
+)
+
+// TestLoadKeysInfersSignMethodFromECDSACurve confirms a config that never
+// sets TokenSignMethod still ends up pinned after LoadKeys, closing the
+// alg-substitution gap ValidateSignMethodAlgorithm otherwise leaves open for
+// the default (unset) TokenSignMethod.
+func TestLoadKeysInfersSignMethodFromECDSACurve(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der := writeTempECDSAKey(t, key)
+
+	c := &CommonTokenConfig{}
+	c.TokenECDSAFile = der
+	if err := c.LoadKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if c.TokenSignMethod != MethodES384 {
+		t.Fatalf("expected TokenSignMethod to be inferred as %q, got %q", MethodES384, c.TokenSignMethod)
+	}
+
+	// The inferred method now actively rejects alg substitution, not just a
+	// method an operator happened to set explicitly.
+	if err := c.ValidateSignMethodAlgorithm(MethodHS256); err == nil {
+		t.Fatal("expected the inferred ES384 sign method to reject a substituted HS256 alg")
+	}
+}
+
+// TestLoadKeysDoesNotOverrideExplicitSignMethod confirms inference never
+// clobbers a TokenSignMethod the operator set themselves.
+func TestLoadKeysDoesNotOverrideExplicitSignMethod(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der := writeTempECDSAKey(t, key)
+
+	c := &CommonTokenConfig{TokenSignMethod: MethodES256}
+	c.TokenECDSAFile = der
+	if err := c.LoadKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if c.TokenSignMethod != MethodES256 {
+		t.Fatalf("expected explicit TokenSignMethod to be left alone, got %q", c.TokenSignMethod)
+	}
+}
+
+// TestInferSignMethodFromKeysAmbiguousTypesYieldsEmpty confirms mixing key
+// types (no single correct alg to pin to) leaves TokenSignMethod unset,
+// same as before this inference existed.
+func TestInferSignMethodFromKeysAmbiguousTypesYieldsEmpty(t *testing.T) {
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]interface{}{
+		"a": p256Key,
+		"b": "a-shared-secret",
+	}
+	if got := inferSignMethodFromKeys(keys); got != "" {
+		t.Fatalf("expected ambiguous key types to infer no sign method, got %q", got)
+	}
+}
+
+func writeTempECDSAKey(t *testing.T, key *ecdsa.PrivateKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	path := t.TempDir() + "/ecdsa.key"
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
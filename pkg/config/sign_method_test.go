@@ -0,0 +1,78 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+)
+
+func TestValidateSignMethodAlgorithm(t *testing.T) {
+	testcases := []struct {
+		name            string
+		tokenSignMethod string
+		alg             string
+		wantErr         bool
+	}{
+		{name: "matching alg", tokenSignMethod: MethodRS256, alg: MethodRS256, wantErr: false},
+		{name: "substituted weaker alg", tokenSignMethod: MethodRS256, alg: MethodHS256, wantErr: true},
+		{name: "substituted different rsa variant", tokenSignMethod: MethodRS256, alg: MethodRS512, wantErr: true},
+		{name: "unpinned sign method allows any alg", tokenSignMethod: "", alg: MethodHS256, wantErr: false},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &CommonTokenConfig{TokenSignMethod: tc.tokenSignMethod}
+			err := c.ValidateSignMethodAlgorithm(tc.alg)
+			if tc.wantErr && err == nil {
+				t.Fatalf("expected error for alg %q against sign method %q, got nil", tc.alg, tc.tokenSignMethod)
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("unexpected error for alg %q against sign method %q: %v", tc.alg, tc.tokenSignMethod, err)
+			}
+		})
+	}
+}
+
+func TestValidateECDSAKeyCurvePinning(t *testing.T) {
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := validateECDSAKeyCurve(p256Key, elliptic.P256()); err != nil {
+		t.Fatalf("expected P-256 key to satisfy ES256, got error: %v", err)
+	}
+	if err := validateECDSAKeyCurve(p384Key, elliptic.P256()); err == nil {
+		t.Fatal("expected P-384 key to be rejected for an ES256 (P-256) configuration")
+	}
+}
+
+func TestAddKeyRejectsMismatchedCurve(t *testing.T) {
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &CommonTokenConfig{TokenSignMethod: MethodES256}
+	if err := c.AddKey("0", p384Key); err == nil {
+		t.Fatal("expected AddKey to reject a P-384 key under an ES256 (P-256) configuration")
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"crypto"
+	"net/url"
+
+	jwterrors "github.com/greenpau/caddy-auth-jwt/pkg/errors"
+)
+
+// Signer abstracts producing a JWS signature over digest for the given
+// TokenSignMethod, so that a private key never has to leave a KMS/HSM to
+// sign a token. Implementations are looked up by the scheme of
+// TokenSignerURI; see NewSigner.
+type Signer interface {
+	Sign(ctx context.Context, alg string, digest []byte) ([]byte, error)
+	Public() crypto.PublicKey
+}
+
+// Verifier is the read side of Signer: it checks a signature against a
+// digest using key material that, for a remote backend, is only its public
+// half.
+type Verifier interface {
+	Verify(ctx context.Context, alg string, digest, signature []byte) error
+	Public() crypto.PublicKey
+}
+
+// signerFactories maps a TokenSignerURI scheme to the constructor for its
+// Signer. Backends register themselves in their own file's init(), so the
+// core package only needs to know about the file-backed default.
+var signerFactories = map[string]func(u *url.URL) (Signer, error){}
+
+// RegisterSignerScheme makes a Signer backend available under scheme for
+// TokenSignerURI, e.g. "awskms", "gcpkms", "vault", "pkcs11". It is meant to
+// be called from an init() function in the package implementing the
+// backend.
+func RegisterSignerScheme(scheme string, factory func(u *url.URL) (Signer, error)) {
+	signerFactories[scheme] = factory
+}
+
+// NewSigner builds a Signer from a TokenSignerURI, e.g.
+// "awskms://alias/jwt-signer?region=us-east-1", "gcpkms://projects/p/locations/l/keyRings/r/cryptoKeys/k",
+// "vault://transit/keys/jwt", or "pkcs11:token=...;object=...". If uri is
+// empty, NewSigner wraps c's locally configured private key instead.
+func NewSigner(uri string, c *CommonTokenConfig) (Signer, error) {
+	if uri == "" {
+		return newFileSigner(c)
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, jwterrors.ErrInvalidSignerURI.WithArgs(uri, err)
+	}
+	scheme := u.Scheme
+	if scheme == "" {
+		// A URI with no scheme at all is treated as a pkcs11 one. An RFC
+		// 7512 "pkcs11:..." URI already parses with scheme "pkcs11".
+		scheme = "pkcs11"
+	}
+	factory, exists := signerFactories[scheme]
+	if !exists {
+		return nil, jwterrors.ErrUnsupportedSignerScheme.WithArgs(scheme)
+	}
+	return factory(u)
+}
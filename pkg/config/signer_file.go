@@ -0,0 +1,120 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+
+	jwterrors "github.com/greenpau/caddy-auth-jwt/pkg/errors"
+)
+
+// fileSigner implements Signer on top of the private key material
+// CommonTokenConfig already loads from disk/config (TokenRSAKey, TokenECDSAKey,
+// TokenEdDSAKey, ...). It exists so the rest of the codebase can depend on
+// the Signer interface uniformly and migrate to a remote KMS backend later
+// without touching call sites.
+type fileSigner struct {
+	key interface{}
+	pub crypto.PublicKey
+}
+
+func newFileSigner(c *CommonTokenConfig) (*fileSigner, error) {
+	key, _, err := c.GetPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &fileSigner{key: k, pub: &k.PublicKey}, nil
+	case *ecdsa.PrivateKey:
+		return &fileSigner{key: k, pub: &k.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &fileSigner{key: k, pub: k.Public()}, nil
+	default:
+		return nil, jwterrors.ErrUnsupportedKeyType.WithArgs(key, "signer")
+	}
+}
+
+// Public returns the public half of the wrapped private key.
+func (s *fileSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign produces a JWS signature over digest for alg. For EdDSA, digest is
+// the full message: Ed25519 signs its input directly rather than a
+// pre-hashed digest, which is why it cannot be combined with RFC 7518's
+// other "alg" values in a generic digest-based interface.
+func (s *fileSigner) Sign(ctx context.Context, alg string, digest []byte) ([]byte, error) {
+	if err := ValidateSignMethod(alg); err != nil {
+		return nil, err
+	}
+	switch k := s.key.(type) {
+	case *rsa.PrivateKey:
+		hash, opts, err := rsaHashOpts(alg)
+		if err != nil {
+			return nil, err
+		}
+		if opts != nil {
+			return rsa.SignPSS(rand.Reader, k, hash, digest, opts)
+		}
+		return rsa.SignPKCS1v15(rand.Reader, k, hash, digest)
+	case *ecdsa.PrivateKey:
+		return signECDSA(rand.Reader, k, digest)
+	case ed25519.PrivateKey:
+		return ed25519.Sign(k, digest), nil
+	default:
+		return nil, jwterrors.ErrUnsupportedKeyType.WithArgs(k, "signer")
+	}
+}
+
+// signECDSA produces the fixed-width r||s signature JWS expects (RFC 7518
+// Section 3.4), rather than the variable-length ASN.1 DER form
+// ecdsa.SignASN1 returns.
+func signECDSA(rnd io.Reader, k *ecdsa.PrivateKey, digest []byte) ([]byte, error) {
+	r, s, err := ecdsa.Sign(rnd, k, digest)
+	if err != nil {
+		return nil, err
+	}
+	size := (k.Curve.Params().BitSize + 7) / 8
+	out := make([]byte, 2*size)
+	r.FillBytes(out[:size])
+	s.FillBytes(out[size:])
+	return out, nil
+}
+
+func rsaHashOpts(alg string) (crypto.Hash, *rsa.PSSOptions, error) {
+	switch alg {
+	case MethodRS256:
+		return crypto.SHA256, nil, nil
+	case MethodRS384:
+		return crypto.SHA384, nil, nil
+	case MethodRS512:
+		return crypto.SHA512, nil, nil
+	case MethodPS256:
+		return crypto.SHA256, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}, nil
+	case MethodPS384:
+		return crypto.SHA384, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA384}, nil
+	case MethodPS512:
+		return crypto.SHA512, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA512}, nil
+	default:
+		return 0, nil, jwterrors.ErrUnsupportedSignMethod.WithArgs(alg)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+)
+
+// TestFileSignerRS256RoundTrip confirms a Signer built over an RSA key signs
+// a digest that verifies against its own Public().
+func TestFileSignerRS256RoundTrip(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &CommonTokenConfig{}
+	if err := c.AddKey("k1", key); err != nil {
+		t.Fatal(err)
+	}
+	s, err := newFileSigner(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := sha256.Sum256([]byte("the quick brown fox"))
+	sig, err := s.Sign(context.Background(), MethodRS256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, ok := s.Public().(*rsa.PublicKey)
+	if !ok {
+		t.Fatalf("expected *rsa.PublicKey, got %T", s.Public())
+	}
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+		t.Fatalf("signature did not verify: %v", err)
+	}
+}
+
+// TestFileSignerES256RoundTrip confirms a Signer built over an ECDSA key
+// produces the fixed-width r||s signature JWS expects, and that it verifies.
+func TestFileSignerES256RoundTrip(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &CommonTokenConfig{}
+	if err := c.AddKey("k1", key); err != nil {
+		t.Fatal(err)
+	}
+	s, err := newFileSigner(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := sha256.Sum256([]byte("the quick brown fox"))
+	sig, err := s.Sign(context.Background(), MethodES256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sig) != 64 {
+		t.Fatalf("expected a 64-byte r||s signature for P-256, got %d bytes", len(sig))
+	}
+	r := new(big.Int).SetBytes(sig[:32])
+	ss := new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(&key.PublicKey, digest[:], r, ss) {
+		t.Fatal("signature did not verify")
+	}
+}
+
+// TestFileSignerEdDSARoundTrip confirms a Signer built over an Ed25519 key
+// signs the message directly (not a pre-hashed digest) and verifies.
+func TestFileSignerEdDSARoundTrip(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &CommonTokenConfig{}
+	if err := c.AddKey("k1", priv); err != nil {
+		t.Fatal(err)
+	}
+	s, err := newFileSigner(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := []byte("the quick brown fox")
+	sig, err := s.Sign(context.Background(), MethodEdDSA, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(pub, msg, sig) {
+		t.Fatal("signature did not verify")
+	}
+}
+
+// TestFileSignerRejectsUnsupportedAlg confirms Sign validates alg before
+// touching the key.
+func TestFileSignerRejectsUnsupportedAlg(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &CommonTokenConfig{}
+	if err := c.AddKey("k1", key); err != nil {
+		t.Fatal(err)
+	}
+	s, err := newFileSigner(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Sign(context.Background(), "none", []byte("digest")); err == nil {
+		t.Fatal("expected an error for an unsupported alg")
+	}
+}
+
+// TestNewSignerEmptyURIWrapsLocalKey confirms NewSigner with no
+// TokenSignerURI falls back to the locally configured key.
+func TestNewSignerEmptyURIWrapsLocalKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &CommonTokenConfig{}
+	if err := c.AddKey("k1", key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSigner("", c); err != nil {
+		t.Fatalf("expected NewSigner to succeed with the local key, got: %v", err)
+	}
+}
+
+// TestNewSignerRejectsUnregisteredScheme confirms an unknown TokenSignerURI
+// scheme is rejected rather than silently falling back to the file signer.
+func TestNewSignerRejectsUnregisteredScheme(t *testing.T) {
+	c := &CommonTokenConfig{}
+	if _, err := NewSigner("notarealscheme://somewhere", c); err == nil {
+		t.Fatal("expected an error for an unregistered signer scheme")
+	}
+}
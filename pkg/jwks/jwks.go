@@ -0,0 +1,136 @@
+// Copyright 2020 Paul Greenberg greenpau@outlook.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jwks provides the types needed to publish and parse JSON Web Key
+// Sets, as defined in RFC 7517, for the subset of key types caddy-auth-jwt
+// signs and verifies with: RSA, ECDSA, and Ed25519.
+package jwks
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+)
+
+// Key is a single entry of a JSON Web Key Set.
+type Key struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+}
+
+// KeySet is a JSON Web Key Set, as served at e.g. /.well-known/jwks.json.
+type KeySet struct {
+	Keys []Key `json:"keys"`
+}
+
+// NewKeySet returns an empty KeySet.
+func NewKeySet() *KeySet {
+	return &KeySet{Keys: []Key{}}
+}
+
+// AddKey derives a Key from pub and appends it to ks. Only public key
+// material is ever serialized; passing a private key extracts its public
+// half.
+func (ks *KeySet) AddKey(kid string, pub interface{}) error {
+	k, err := newKey(kid, pub)
+	if err != nil {
+		return err
+	}
+	ks.Keys = append(ks.Keys, *k)
+	return nil
+}
+
+func newKey(kid string, pub interface{}) (*Key, error) {
+	switch p := pub.(type) {
+	case *rsa.PrivateKey:
+		return newKey(kid, &p.PublicKey)
+	case *rsa.PublicKey:
+		return &Key{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(p.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(bigEndianUint(p.E)),
+		}, nil
+	case *ecdsa.PrivateKey:
+		return newKey(kid, &p.PublicKey)
+	case *ecdsa.PublicKey:
+		crv, size, err := curveName(p.Curve.Params().BitSize)
+		if err != nil {
+			return nil, err
+		}
+		return &Key{
+			Kty: "EC",
+			Kid: kid,
+			Use: "sig",
+			Crv: crv,
+			X:   base64.RawURLEncoding.EncodeToString(leftPad(p.X.Bytes(), size)),
+			Y:   base64.RawURLEncoding.EncodeToString(leftPad(p.Y.Bytes(), size)),
+		}, nil
+	case ed25519.PrivateKey:
+		return newKey(kid, p.Public().(ed25519.PublicKey))
+	case ed25519.PublicKey:
+		return &Key{
+			Kty: "OKP",
+			Kid: kid,
+			Use: "sig",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(p),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T for kid %q", pub, kid)
+	}
+}
+
+func curveName(bitSize int) (name string, byteSize int, err error) {
+	switch bitSize {
+	case 256:
+		return "P-256", 32, nil
+	case 384:
+		return "P-384", 48, nil
+	case 521:
+		return "P-521", 66, nil
+	default:
+		return "", 0, fmt.Errorf("unsupported ECDSA curve bit size %d", bitSize)
+	}
+}
+
+func leftPad(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
+
+func bigEndianUint(n int) []byte {
+	b := []byte{byte(n >> 16), byte(n >> 8), byte(n)}
+	i := 0
+	for i < len(b)-1 && b[i] == 0 {
+		i++
+	}
+	return b[i:]
+}